@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// aggregator replaces the samples of some fields in a batch with one
+// summary point per series and field: count, sum, min, max, the requested
+// percentiles and, optionally, cumulative histogram bucket counts.
+// Percentiles are exact, computed on the samples of the batch.
+type aggregator struct {
+	fields      map[string]bool
+	percentiles []float64
+	buckets     []float64
+}
+
+// parseFloats parses a comma separated list of numbers.
+func parseFloats(s string) ([]float64, error) {
+	var fs []float64
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", v)
+		}
+		fs = append(fs, f)
+	}
+	return fs, nil
+}
+
+func newAggregator(fields []string, percentiles, buckets string) (*aggregator, error) {
+	a := &aggregator{fields: make(map[string]bool)}
+	for _, f := range fields {
+		a.fields[f] = true
+	}
+	var err error
+	if a.percentiles, err = parseFloats(percentiles); err != nil {
+		return nil, fmt.Errorf("invalid percentiles: %v", err)
+	}
+	for _, p := range a.percentiles {
+		if p <= 0 || p > 100 {
+			return nil, fmt.Errorf("invalid percentile %v: must be in (0, 100]", p)
+		}
+	}
+	if a.buckets, err = parseFloats(buckets); err != nil {
+		return nil, fmt.Errorf("invalid histogram buckets: %v", err)
+	}
+	sort.Float64s(a.buckets)
+	return a, nil
+}
+
+type samples struct {
+	p      *point // series and latest timestamp
+	values []float64
+}
+
+// aggregate returns the lines with the aggregated fields removed and the
+// summary points added in place of the first sample of each series.
+// Points left without fields are dropped. Lines that cannot be parsed are
+// kept as they are.
+func (a *aggregator) aggregate(lines []string) []string {
+	out := make([]string, 0, len(lines))
+	series := make(map[string]*samples)
+	index := make(map[string]int) // position in out
+	var order []string
+	for _, line := range lines {
+		p, err := parsePoint(line)
+		if err != nil {
+			out = append(out, line)
+			continue
+		}
+		var (
+			key    string
+			fields = p.fields[:0]
+		)
+		for _, f := range p.fields {
+			v, ok := fieldFloat(f.value)
+			if !a.fields[f.key] || !ok {
+				fields = append(fields, f)
+				continue
+			}
+			if key == "" {
+				key = seriesKey(p)
+			}
+			k := key + " " + f.key
+			s, ok := series[k]
+			if !ok {
+				s = &samples{p: &point{measurement: p.measurement, tags: p.tags}}
+				series[k] = s
+				index[k] = len(out)
+				order = append(order, k)
+				out = append(out, "")
+			}
+			s.values = append(s.values, v)
+			if p.hasTime && (!s.p.hasTime || p.time > s.p.time) {
+				s.p.time, s.p.hasTime = p.time, true
+			}
+		}
+		p.fields = fields
+		if key == "" {
+			out = append(out, line)
+		} else if len(p.fields) > 0 {
+			out = append(out, p.String())
+		}
+	}
+	for _, k := range order {
+		name := k[strings.LastIndexByte(k, ' ')+1:]
+		out[index[k]] = a.summary(series[k], name)
+	}
+	return out
+}
+
+func (a *aggregator) summary(s *samples, name string) string {
+	vs := s.values
+	sort.Float64s(vs)
+	sum := 0.0
+	for _, v := range vs {
+		sum += v
+	}
+	p := s.p
+	p.fields = nil
+	p.setField(name+"_count", strconv.Itoa(len(vs))+"i")
+	p.setField(name+"_sum", formatFloat(sum))
+	p.setField(name+"_min", formatFloat(vs[0]))
+	p.setField(name+"_max", formatFloat(vs[len(vs)-1]))
+	for _, pc := range a.percentiles {
+		// nearest rank
+		i := int(math.Ceil(pc/100*float64(len(vs)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		p.setField(name+"_p"+formatFloat(pc), formatFloat(vs[i]))
+	}
+	for _, b := range a.buckets {
+		n := sort.Search(len(vs), func(i int) bool { return vs[i] > b })
+		p.setField(name+"_le_"+formatFloat(b), strconv.Itoa(n)+"i")
+	}
+	return p.String()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
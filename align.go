@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// precisionUnit returns the duration of a timestamp unit as set by the
+// precision parameter of the endpoint.
+func precisionUnit(endpoint string) (time.Duration, error) {
+	if endpoint == "" {
+		return time.Nanosecond, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return 0, err
+	}
+	switch p := u.Query().Get("precision"); p {
+	case "", "n", "ns":
+		return time.Nanosecond, nil
+	case "u", "us":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	default:
+		return 0, fmt.Errorf("unknown precision %q", p)
+	}
+}
+
+// alignTransform floors timestamps to a multiple of every. Points without
+// timestamp get the current time, aligned.
+type alignTransform struct {
+	every time.Duration
+	unit  time.Duration // of timestamps
+}
+
+func (a alignTransform) String() string {
+	return fmt.Sprintf("align timestamps to %v", a.every)
+}
+
+func (a alignTransform) apply(p *point) bool {
+	var t time.Duration
+	if p.hasTime {
+		t = time.Duration(p.time) * a.unit
+	} else {
+		t = time.Duration(skew.now().UnixNano())
+	}
+	// floor, also for timestamps before 1970
+	if m := t % a.every; m < 0 {
+		t -= m + a.every
+	} else {
+		t -= m
+	}
+	p.time, p.hasTime = int64(t/a.unit), true
+	return true
+}
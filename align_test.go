@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAlignFloors(t *testing.T) {
+	a := alignTransform{every: 10 * time.Second, unit: time.Second}
+	for _, c := range []struct{ in, want int64 }{
+		{0, 0},
+		{15, 10},
+		{20, 20},
+		{-1, -10},
+		{-15, -20},
+		{-20, -20},
+	} {
+		p := &point{measurement: "m", time: c.in, hasTime: true}
+		a.apply(p)
+		if p.time != c.want {
+			t.Errorf("aligned %d to %d, want %d", c.in, p.time, c.want)
+		}
+	}
+}
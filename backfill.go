@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// backfillFile is a file to backfill, decompressed if its name ends in
+// .gz. Offsets in the content are counted after decompression, while
+// read counts the bytes read from the file to report the progress.
+type backfillFile struct {
+	f    *os.File
+	r    io.Reader
+	read int64
+	gzip bool
+}
+
+func openBackfill(file string) (*backfillFile, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	bf := &backfillFile{f: f, r: f}
+	if strings.HasSuffix(file, ".gz") {
+		zr, err := gzip.NewReader(bufio.NewReader(countReader{f, &bf.read}))
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		bf.r, bf.gzip = zr, true
+	}
+	return bf, nil
+}
+
+// position returns how much of the file was read, given the offset in the
+// content.
+func (bf *backfillFile) position(offset int64) int64 {
+	if bf.gzip {
+		return bf.read
+	}
+	return offset
+}
+
+// skip moves to offset in the content, returning false if it is past the
+// end.
+func (bf *backfillFile) skip(offset, size int64) (bool, error) {
+	if !bf.gzip {
+		if offset >= size {
+			return false, nil
+		}
+		_, err := bf.f.Seek(offset, io.SeekStart)
+		return true, err
+	}
+	if _, err := io.CopyN(ioutil.Discard, bf.r, offset); err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, err
+	}
+	// the backfill is completed unless more content follows
+	var b [1]byte
+	if _, err := io.ReadFull(bf.r, b[:]); err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, err
+	}
+	bf.r = io.MultiReader(bytes.NewReader(b[:]), bf.r)
+	return true, nil
+}
+
+func (bf *backfillFile) Close() error {
+	return bf.f.Close()
+}
+
+type countReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+// timeShift moves the timestamps of backfilled lines, either by a duration
+// or so that the first timestamp of the file becomes start, keeping the
+// spacing between points.
+type timeShift struct {
+	by    time.Duration
+	start time.Time
+	unit  time.Duration // precision of the timestamps
+}
+
+// units returns the shift in units of the precision for the file.
+func (t timeShift) units(file string) (int64, error) {
+	if t.start.IsZero() {
+		return int64(t.by / t.unit), nil
+	}
+	bf, err := openBackfill(file)
+	if err != nil {
+		return 0, err
+	}
+	defer bf.Close()
+	first, ok, err := firstTimestamp(bf.r)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return t.start.UnixNano()/int64(t.unit) - first, nil
+}
+
+// firstTimestamp returns the timestamp of the first line that has one.
+func firstTimestamp(r io.Reader) (int64, bool, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if p, err := parsePoint(line); err == nil && p.hasTime {
+			return p.time, true, nil
+		}
+	}
+	return 0, false, sc.Err()
+}
+
+// shiftTimes adds shift to the timestamps of the lines.
+func shiftTimes(lines []string, shift int64) {
+	for i, l := range lines {
+		if p, err := parsePoint(l); err == nil && p.hasTime {
+			p.time += shift
+			lines[i] = p.String()
+		}
+	}
+}
+
+// backfill writes the line protocol file in batches of nbatch lines through
+// the submitter, at most rate lines per second, waiting for each batch to
+// be accepted before sending the next. Lines of a batch are sorted by time,
+// after their timestamps are moved by shift. After each batch the offset
+// of the next line is written to checkpoint, so that an interrupted
+// backfill resumes where it stopped. Files ending in .gz are decompressed.
+func backfill(ctx context.Context, s *submitter, file, checkpoint string, nbatch, rate int, shift timeShift) error {
+	f, err := openBackfill(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	delta, err := shift.units(file)
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %v", file, err)
+	}
+	fi, err := f.f.Stat()
+	if err != nil {
+		return err
+	}
+	offset, err := readCheckpoint(checkpoint)
+	if err != nil {
+		return fmt.Errorf("cannot read checkpoint: %v", err)
+	}
+	if offset > 0 {
+		more, err := f.skip(offset, fi.Size())
+		if err != nil {
+			return fmt.Errorf("cannot resume at byte %d: %v", offset, err)
+		}
+		if !more {
+			ilog.Printf("backfill of %s already completed, remove %s to start again", file, checkpoint)
+			return nil
+		}
+		ilog.Printf("resuming backfill of %s at byte %d of %d", file, f.position(offset), fi.Size())
+	}
+	r := bufio.NewReader(f.r)
+	var (
+		start    = time.Now()
+		sent     int
+		next     = start // time the next batch can be sent
+		progress = time.NewTicker(10 * time.Second)
+	)
+	defer progress.Stop()
+	for {
+		lines, n, err := readBatch(r, nbatch)
+		if err != nil {
+			return fmt.Errorf("cannot read %s: %v", file, err)
+		}
+		if len(lines) == 0 {
+			break
+		}
+		if delta != 0 {
+			shiftTimes(lines, delta)
+		}
+		sortByTime(lines)
+		if !sleep(ctx, time.Until(next)) {
+			return fmt.Errorf("interrupted at byte %d, run again to resume", offset)
+		}
+		b := []byte(strings.Join(lines, "\n") + "\n")
+		if err := s.deliver(ctx, b); err != nil {
+			return fmt.Errorf("stopped at byte %d, run again to resume: %v", offset, err)
+		}
+		offset += n
+		sent += len(lines)
+		if err := writeCheckpoint(checkpoint, offset); err != nil {
+			return fmt.Errorf("cannot write checkpoint: %v", err)
+		}
+		if rate > 0 {
+			next = next.Add(time.Duration(int64(time.Second) * int64(len(lines)) / int64(rate)))
+		}
+		select {
+		case <-progress.C:
+			logBackfill(f.position(offset), fi.Size(), sent, time.Since(start))
+		default:
+		}
+	}
+	logBackfill(f.position(offset), fi.Size(), sent, time.Since(start))
+	return nil
+}
+
+func logBackfill(offset, size int64, sent int, elapsed time.Duration) {
+	done := 100.0
+	if size > 0 {
+		done = float64(offset) * 100 / float64(size)
+	}
+	msg := fmt.Sprintf("backfill: %.1f%% done, %d lines sent at %.1f lines/s", done, sent, float64(sent)/elapsed.Seconds())
+	if offset < size && offset > 0 {
+		eta := time.Duration(float64(elapsed) * float64(size-offset) / float64(offset))
+		msg += fmt.Sprintf(", %v left", eta.Round(time.Second))
+	}
+	ilog.Print(msg)
+}
+
+// readBatch reads up to n measurements, skipping empty lines and comments,
+// and returns them with the number of bytes read.
+func readBatch(r *bufio.Reader, n int) ([]string, int64, error) {
+	var (
+		lines []string
+		size  int64
+	)
+	for len(lines) < n {
+		line, err := r.ReadString('\n')
+		size += int64(len(line))
+		if line = strings.TrimSpace(line); line != "" && line[0] != '#' {
+			lines = append(lines, line)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return lines, size, nil
+}
+
+// sortByTime sorts the lines by timestamp, keeping the order of lines
+// with the same or no timestamp.
+func sortByTime(lines []string) {
+	times := make(map[string]int64, len(lines))
+	for _, l := range lines {
+		if p, err := parsePoint(l); err == nil && p.hasTime {
+			times[l] = p.time
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return times[lines[i]] < times[lines[j]] })
+}
+
+func readCheckpoint(file string) (int64, error) {
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(bytes.TrimSpace(b)), 10, 64)
+}
+
+// writeCheckpoint atomically replaces the checkpoint file.
+func writeCheckpoint(file string, offset int64) error {
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(strconv.FormatInt(offset, 10)+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+func (b *batchCollector) String() string {
+	s := "InfluxDB " + redactURL(b.submitter.endpoint.Load().(string))
+	if b.submitter.discard {
+		s = "discard"
+	}
+	if b.submitter.db != "" {
+		s += " db " + b.submitter.db
+	}
+	if b.rp != "" {
+		s += " rp " + b.rp
+	}
+	s += fmt.Sprintf(", batches of %d lines or %v", b.nbatch, b.tbatch)
+	if b.merge {
+		s += ", merged"
+	}
+	if b.aggregate != nil {
+		s += ", aggregated"
+	}
+	return s
+}
+
+func (d *downsampler) String() string {
+	s := "InfluxDB " + redactURL(d.submitter.endpoint.Load().(string))
+	if d.submitter.discard {
+		s = "discard"
+	}
+	if d.submitter.db != "" {
+		s += " db " + d.submitter.db
+	}
+	if d.submitter.rp != "" {
+		s += " rp " + d.submitter.rp
+	}
+	return s + fmt.Sprintf(", means every %v", d.every)
+}
+
+// writerName describes where w writes to.
+func writerName(w io.Writer) string {
+	if f, ok := w.(*os.File); ok {
+		return f.Name()
+	}
+	return fmt.Sprintf("%T", w)
+}
+
+func (p printCollector) String() string {
+	return "print to " + writerName(p.w)
+}
+
+func (c csvCollector) String() string {
+	return "annotated CSV to " + writerName(c.w)
+}
+
+// describe returns the String of v, if it has one, or its type.
+func describe(v interface{}) string {
+	if s, ok := v.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// logPipeline logs a description of the assembled pipeline: where
+// measurements come from, how they are transformed and where they go.
+func logPipeline(ins []input, ts []transform, cs []collector) {
+	var inputs []string
+	for _, in := range ins {
+		inputs = append(inputs, describe(in))
+	}
+	transforms := []string{"none"}
+	if len(ts) > 0 {
+		transforms = transforms[:0]
+		for _, t := range ts {
+			transforms = append(transforms, describe(t))
+		}
+	}
+	var sinks []string
+	for _, c := range cs {
+		sinks = append(sinks, describe(c))
+	}
+	ilog.Printf("inputs: %s", strings.Join(inputs, "; "))
+	ilog.Printf("transforms: %s", strings.Join(transforms, "; "))
+	ilog.Printf("sinks: %s", strings.Join(sinks, "; "))
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+type benchResult struct {
+	latency time.Duration
+	err     error
+}
+
+// benchInterval returns the time between batches of nbatch lines sent at
+// rate lines per second. It is not positive when the rate is too high.
+func benchInterval(nbatch, rate int) time.Duration {
+	return time.Duration(int64(time.Second) * int64(nbatch) / int64(rate))
+}
+
+// bench drives synthetic batches of nbatch lines through the submitter at
+// the given rate of lines per second for duration d, then writes a report
+// of the achieved throughput, latencies and errors to w.
+func bench(ctx context.Context, w io.Writer, s *submitter, g *generator, nworkers, nbatch, rate int, d time.Duration) {
+	batches := make(chan []byte)
+	results := make(chan benchResult)
+	var wg sync.WaitGroup
+	for i := 0; i < nworkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range batches {
+				start := time.Now()
+				err := s.send(ctx, bytes.NewReader(b), "")
+				results <- benchResult{time.Since(start), err}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	start := time.Now()
+	go func() {
+		tick := time.NewTicker(benchInterval(nbatch, rate))
+		defer tick.Stop()
+		for now := range tick.C {
+			if now.Sub(start) >= d || ctx.Err() != nil {
+				break
+			}
+			var buf bytes.Buffer
+			for i := 0; i < nbatch; i++ {
+				fmt.Fprintln(&buf, g.next(now))
+			}
+			batches <- buf.Bytes()
+		}
+		close(batches)
+	}()
+
+	var (
+		latencies []time.Duration
+		errs      int
+	)
+	for r := range results {
+		if r.err != nil {
+			errs++
+			elog.Printf("bench: %v", r.err)
+			continue
+		}
+		latencies = append(latencies, r.latency)
+	}
+	elapsed := time.Since(start)
+
+	total := len(latencies) + errs
+	fmt.Fprintf(w, "batches: %d sent, %d failed (%.2f%% errors)\n", total, errs, percent(errs, total))
+	fmt.Fprintf(w, "throughput: %.1f lines/s (requested %d lines/s)\n", float64(len(latencies)*nbatch)/elapsed.Seconds(), rate)
+	if len(latencies) == 0 {
+		return
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	fmt.Fprintf(w, "latency: p50 %v, p90 %v, p99 %v, max %v\n",
+		percentile(latencies, 50), percentile(latencies, 90), percentile(latencies, 99), latencies[len(latencies)-1])
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
+
+// percentile returns the p-th percentile of sorted durations.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	return sorted[(len(sorted)-1)*p/100]
+}
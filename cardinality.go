@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// cardinalityTransform drops the points of new series once max distinct
+// series have been seen.
+type cardinalityTransform struct {
+	max int
+
+	mux     sync.Mutex
+	series  map[string]struct{}
+	dropped int // since the last report
+	lastLog time.Time
+}
+
+func newCardinalityTransform(max int) *cardinalityTransform {
+	return &cardinalityTransform{
+		max:    max,
+		series: make(map[string]struct{}),
+	}
+}
+
+func (c *cardinalityTransform) String() string {
+	return fmt.Sprintf("limit to %d series", c.max)
+}
+
+// seriesKey returns the measurement and the sorted tags of a point.
+func seriesKey(p *point) string {
+	tags := make([]tag, len(p.tags))
+	copy(tags, p.tags)
+	sort.Slice(tags, func(i, j int) bool { return tags[i].key < tags[j].key })
+	return (&point{measurement: p.measurement, tags: tags}).String()
+}
+
+func (c *cardinalityTransform) apply(p *point) bool {
+	key := seriesKey(p)
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if _, ok := c.series[key]; ok {
+		return true
+	}
+	if len(c.series) < c.max {
+		c.series[key] = struct{}{}
+		return true
+	}
+	stats.Add("series_dropped", 1)
+	c.dropped++
+	if now := time.Now(); now.Sub(c.lastLog) >= time.Minute {
+		elog.Printf("SERIES LIMIT OF %d REACHED: dropped %d measurements of new series, like %s", c.max, c.dropped, key)
+		c.dropped, c.lastLog = 0, now
+	}
+	return false
+}
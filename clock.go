@@ -0,0 +1,60 @@
+package main
+
+import (
+	"time"
+)
+
+// clock is the time source of influxin. For tests it can be replaced by a
+// fake clock, frozen at a given time or running faster than the real one,
+// so that batch timers, schedules and retries can be exercised
+// deterministically and without waiting.
+type clock interface {
+	// now returns the time given to measurements.
+	now() time.Time
+	// wait returns the real duration to wait for d to pass on the clock.
+	wait(d time.Duration) time.Duration
+}
+
+// clk is the clock in use, replaced by -frozen-time and -time-scale.
+var clk clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) now() time.Time {
+	return time.Now()
+}
+
+func (realClock) wait(d time.Duration) time.Duration {
+	return d
+}
+
+// fakeClock starts at base and runs scale times faster than the real
+// clock, or always returns base when frozen. Its timers fire after their
+// duration divided by scale in both cases.
+type fakeClock struct {
+	start  time.Time // real time when the clock was created
+	base   time.Time
+	scale  float64
+	frozen bool
+}
+
+func newFakeClock(base time.Time, frozen bool, scale float64) *fakeClock {
+	return &fakeClock{start: time.Now(), base: base, scale: scale, frozen: frozen}
+}
+
+func (c *fakeClock) now() time.Time {
+	if c.frozen {
+		return c.base
+	}
+	return c.base.Add(time.Duration(float64(time.Since(c.start)) * c.scale))
+}
+
+func (c *fakeClock) wait(d time.Duration) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	if w := time.Duration(float64(d) / c.scale); w > 0 {
+		return w
+	}
+	return 1
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// splitWords splits a command line in words separated by spaces, honoring
+// single and double quotes. Outside single quotes a backslash escapes a
+// following quote or backslash, and is kept otherwise, so that Windows
+// paths like C:\tools\x.exe need no quoting.
+func splitWords(line string) ([]string, error) {
+	var (
+		words  []string
+		word   strings.Builder
+		inWord bool
+		quote  rune
+	)
+	rs := []rune(line)
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case r == '\\' && quote != '\'' && i+1 < len(rs) && strings.ContainsRune(`"'\\`, rs[i+1]):
+			i++
+			word.WriteRune(rs[i])
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", line)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// readCmdfile reads commands from a Procfile-like file: each line is in
+// the form "name: command args...". Empty lines and lines starting with #
+// are ignored.
+func readCmdfile(path string, mkcmd func() cmd) (cmds, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open command file: %v", err)
+	}
+	defer f.Close()
+	var cs cmds
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		c, err := parseCmdLine(line, mkcmd)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		cs = append(cs, c)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read command file: %v", err)
+	}
+	return cs, nil
+}
+
+// parseCmdLine returns the command of a "name: command args..." line.
+func parseCmdLine(line string, mkcmd func() cmd) (cmd, error) {
+	c := mkcmd()
+	i := strings.IndexByte(line, ':')
+	if i <= 0 {
+		return c, errors.New("expected 'name: command'")
+	}
+	c.label, c.line = strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+	words, err := splitWords(c.line)
+	if err != nil {
+		return c, err
+	}
+	if len(words) == 0 {
+		return c, fmt.Errorf("missing command for %s", c.label)
+	}
+	c.name, c.args = words[0], words[1:]
+	return c, nil
+}
+
+func (c *cmd) labelSuffix() string {
+	if c.label == "" {
+		return ""
+	}
+	return " (" + c.label + ")"
+}
+
+// runCmdfile runs the commands read from a command file. On SIGHUP the
+// file is read again, its scripts fetched, and, if valid, the running
+// commands are stopped and replaced by the new ones. A file without
+// commands stops them all.
+func runCmdfile(ctx context.Context, path string, cs cmds, mkcmd func() cmd, tdata *templateData, scripts *scriptLibrary, rs *results, fatal bool) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		rctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func(cs cmds) {
+			cs.run(rctx, rs, fatal)
+			close(done)
+		}(cs)
+		var next cmds
+		for reloaded := false; !reloaded; {
+			select {
+			case <-ctx.Done():
+				cancel()
+				<-done
+				return nil
+			case <-hup:
+			}
+			n, err := readCmdfile(path, mkcmd)
+			if err == nil {
+				err = n.expand(tdata)
+			}
+			if err == nil {
+				err = n.resolveScripts(ctx, scripts)
+			}
+			if err != nil {
+				elog.Printf("not reloading commands: %v", err)
+				continue
+			}
+			next, reloaded = n, true
+		}
+		if len(next) == 0 {
+			ilog.Printf("no commands in %s, stopping all commands", path)
+		} else {
+			ilog.Printf("reloading %d commands from %s", len(next), path)
+		}
+		cancel()
+		<-done
+		cs = next
+	}
+}
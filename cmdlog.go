@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// cmdLogs writes the standard error of each command, and the lines of its
+// standard output that are not measurements, to a rotating log file named
+// after the command, instead of influxin's own output.
+type cmdLogs struct {
+	dir     string
+	maxSize int64
+	keep    int
+	mux     sync.Mutex
+	loggers map[string]*log.Logger // by file, shared by restarts
+}
+
+func newCmdLogs(dir string, maxSize int64, keep int) (*cmdLogs, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create command log directory: %v", err)
+	}
+	return &cmdLogs{dir: dir, maxSize: maxSize, keep: keep, loggers: make(map[string]*log.Logger)}, nil
+}
+
+// logFileName returns the name of the log file of a command.
+func logFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, filepath.Base(name))
+	return strings.TrimLeft(name, ".") + ".log"
+}
+
+// logger returns the logger of the command, opening its file the first
+// time.
+func (l *cmdLogs) logger(name string) (*log.Logger, error) {
+	file := filepath.Join(l.dir, logFileName(name))
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if lg, ok := l.loggers[file]; ok {
+		return lg, nil
+	}
+	f, err := openRotatingFile(file, l.maxSize, l.keep)
+	if err != nil {
+		return nil, err
+	}
+	lg := log.New(f, "", log.LstdFlags)
+	l.loggers[file] = lg
+	return lg, nil
+}
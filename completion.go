@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// enumFlags lists the accepted values of flags that take one of a fixed set
+// of values, for shell completion.
+var enumFlags = map[string][]string{
+	"compress":       compressions,
+	"completion":     {"bash", "zsh", "fish"},
+	"execd":          {"none", "STDIN", "SIGHUP", "SIGUSR1", "SIGUSR2"},
+	"gen-dist":       {"uniform", "normal", "exponential"},
+	"non-finite":     {"keep", "drop", "clamp"},
+	"quota-mode":     {"delay", "drop"},
+	"rc-script":      {"freebsd", "openbsd"},
+	"sink":           {"influx", "discard"},
+	"shell":          {"sh", "cmd", "powershell"},
+	"verbose-buffer": {"line", "block"},
+	"verbose-color":  {"auto", "always", "never"},
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func writeCompletion(w io.Writer, shell string) error {
+	var flags []*flag.Flag
+	flag.VisitAll(func(f *flag.Flag) {
+		flags = append(flags, f)
+	})
+	switch shell {
+	case "bash":
+		writeBashCompletion(w, flags)
+	case "zsh":
+		writeZshCompletion(w, flags)
+	case "fish":
+		writeFishCompletion(w, flags)
+	default:
+		return fmt.Errorf("unsupported shell %q, use one of: %s", shell, strings.Join(enumFlags["completion"], ", "))
+	}
+	return nil
+}
+
+func writeBashCompletion(w io.Writer, flags []*flag.Flag) {
+	var names []string
+	fmt.Fprintln(w, "_influxin() {")
+	fmt.Fprintln(w, "\tlocal cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"")
+	fmt.Fprintln(w, "\tcase \"$prev\" in")
+	for _, f := range flags {
+		names = append(names, "-"+f.Name)
+		if vals, ok := enumFlags[f.Name]; ok {
+			fmt.Fprintf(w, "\t-%s) COMPREPLY=($(compgen -W %s -- \"$cur\")); return;;\n", f.Name, shellQuote(strings.Join(vals, " ")))
+		} else if !isBoolFlag(f) {
+			fmt.Fprintf(w, "\t-%s) COMPREPLY=($(compgen -f -- \"$cur\")); return;;\n", f.Name)
+		}
+	}
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, "\tif [[ \"$cur\" == -* ]]; then")
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %s -- \"$cur\"))\n", shellQuote(strings.Join(names, " ")))
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "\tCOMPREPLY=($(compgen -c -- \"$cur\"))")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -F _influxin influxin")
+}
+
+func writeZshCompletion(w io.Writer, flags []*flag.Flag) {
+	escape := strings.NewReplacer("[", `\[`, "]", `\]`, "'", `'\''`)
+	fmt.Fprintln(w, "#compdef influxin")
+	fmt.Fprintln(w, "_arguments \\")
+	for _, f := range flags {
+		spec := fmt.Sprintf("-%s[%s]", f.Name, escape.Replace(f.Usage))
+		if vals, ok := enumFlags[f.Name]; ok {
+			spec += fmt.Sprintf(":%s:(%s)", f.Name, strings.Join(vals, " "))
+		} else if !isBoolFlag(f) {
+			spec += fmt.Sprintf(":%s:_files", f.Name)
+		}
+		fmt.Fprintf(w, "\t'%s' \\\n", spec)
+	}
+	fmt.Fprintln(w, "\t'*::command:_normal'")
+}
+
+func writeFishCompletion(w io.Writer, flags []*flag.Flag) {
+	for _, f := range flags {
+		line := fmt.Sprintf("complete -c influxin -o %s -d %s", f.Name, shellQuote(f.Usage))
+		if vals, ok := enumFlags[f.Name]; ok {
+			line += fmt.Sprintf(" -x -a %s", shellQuote(strings.Join(vals, " ")))
+		} else if !isBoolFlag(f) {
+			line += " -r"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// compressions lists the supported request body encodings. Zstd and
+// snappy would need libraries outside of the standard library.
+var compressions = []string{"auto", "none", "gzip"}
+
+// checkCompression validates a -compress value.
+func checkCompression(c string) error {
+	switch c {
+	case "auto", "none", "gzip":
+		return nil
+	case "zstd", "snappy":
+		return fmt.Errorf("compression %s is not supported, use gzip", c)
+	}
+	return fmt.Errorf("unknown compression %q, use auto, none or gzip", c)
+}
+
+// compressBody returns the content of r compressed with gzip.
+func compressBody(r io.Reader) (*bytes.Buffer, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.Copy(zw, r); err != nil {
+		return nil, fmt.Errorf("cannot compress batch: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("cannot compress batch: %v", err)
+	}
+	return &buf, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// secretFlags are never printed in clear text.
+var secretFlags = map[string]bool{
+	"admin-token":         true,
+	"password":            true,
+	"oauth-client-secret": true,
+	"token":               true,
+}
+
+// urlFlags may hold credentials in their URL, printed redacted.
+var urlFlags = map[string]bool{
+	"endpoint":        true,
+	"kapacitor":       true,
+	"oauth-token-url": true,
+}
+
+// printConfig writes the effective value of every flag, together with the
+// source that set it, followed by the resolved endpoint and commands.
+func printConfig(w io.Writer, fromEnv, fromFile map[string]string, endpoint string, cmds cmds) {
+	fromArgs := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		fromArgs[f.Name] = true
+	})
+	flag.VisitAll(func(f *flag.Flag) {
+		source := "default"
+		if fromArgs[f.Name] {
+			source = "flag"
+		} else if key, ok := fromEnv[f.Name]; ok {
+			source = "env " + key
+		} else if path, ok := fromFile[f.Name]; ok {
+			source = "config " + path
+		}
+		val := f.Value.String()
+		if secretFlags[f.Name] && val != "" {
+			val = redacted
+		} else if urlFlags[f.Name] {
+			val = redactURL(val)
+		}
+		fmt.Fprintf(w, "%s = %q (%s)\n", f.Name, val, source)
+	})
+	fmt.Fprintf(w, "\nendpoint: %s\n", redactURL(endpoint))
+	for i := range cmds {
+		fmt.Fprintf(w, "command #%d: %s %s\n", i, cmds[i].name, strings.Join(cmds[i].args, " "))
+	}
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// configFile holds the settings of a -config file: the values of the flags,
+// more than one for the flags that can be repeated, and the commands as
+// "name: command args" lines like in a -cmdfile.
+type configFile struct {
+	path     string
+	settings map[string][]string
+	sources  map[string]string // file that set each setting
+	commands []string
+}
+
+// readConfigFile reads a -config file and the files it includes. The
+// include setting lists globs, relative to the directory of the file, of
+// fragments like conf.d/*.toml that are merged in name order: their
+// commands and the values of the flags that can be repeated are added,
+// while other flags can only be set once.
+func readConfigFile(path string) (*configFile, error) {
+	settings, err := readConfigSettings(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &configFile{path: path, settings: settings, sources: make(map[string]string)}
+	for key := range settings {
+		c.sources[key] = path
+	}
+	includes := settings["include"]
+	delete(c.settings, "include")
+	for _, glob := range includes {
+		if !filepath.IsAbs(glob) {
+			glob = filepath.Join(filepath.Dir(path), glob)
+		}
+		files, err := filepath.Glob(glob)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid include %q: %v", path, glob, err)
+		}
+		for _, f := range files {
+			if err := c.include(f); err != nil {
+				return nil, err
+			}
+		}
+	}
+	c.commands = c.settings["commands"]
+	delete(c.settings, "commands")
+	return c, nil
+}
+
+// readConfigSettings reads a JSON file, if its name ends in .json, a YAML
+// file, if it ends in .yaml or .yml, or else a TOML file of "flag = value"
+// lines. Only strings, numbers, booleans and arrays of them are supported.
+func readConfigSettings(path string) (map[string][]string, error) {
+	switch filepath.Ext(path) {
+	case ".json":
+		return readJSONConfig(path)
+	case ".yaml", ".yml":
+		return readYAMLConfig(path)
+	}
+	return readTOMLConfig(path)
+}
+
+// include merges the settings of an included file.
+func (c *configFile) include(path string) error {
+	settings, err := readConfigSettings(path)
+	if err != nil {
+		return err
+	}
+	for key, vals := range settings {
+		if key == "include" {
+			return fmt.Errorf("%s: included files cannot include others", path)
+		}
+		prev, ok := c.sources[key]
+		if ok && !repeatable(key) {
+			return fmt.Errorf("%s: %s is already set in %s", path, key, prev)
+		}
+		if !ok {
+			c.sources[key] = path
+		}
+		c.settings[key] = append(c.settings[key], vals...)
+	}
+	return nil
+}
+
+// repeatable reports whether a setting takes the values of all the files
+// setting it.
+func repeatable(key string) bool {
+	if key == "commands" {
+		return true
+	}
+	f := flag.Lookup(key)
+	if f == nil {
+		return false
+	}
+	_, ok := f.Value.(*stringsFlag)
+	return ok
+}
+
+func readJSONConfig(path string) (map[string][]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config: %v", err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	settings := make(map[string][]string)
+	for key, msg := range raw {
+		var v interface{}
+		d := json.NewDecoder(strings.NewReader(string(msg)))
+		d.UseNumber()
+		if err := d.Decode(&v); err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", path, key, err)
+		}
+		vals, ok := v.([]interface{})
+		if !ok {
+			vals = []interface{}{v}
+		}
+		for _, e := range vals {
+			switch e := e.(type) {
+			case string:
+				settings[key] = append(settings[key], e)
+			case json.Number, bool:
+				settings[key] = append(settings[key], fmt.Sprint(e))
+			default:
+				return nil, fmt.Errorf("%s: %s: expected strings, numbers or booleans", path, key)
+			}
+		}
+	}
+	return settings, nil
+}
+
+func readTOMLConfig(path string) (map[string][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config: %v", err)
+	}
+	defer f.Close()
+	settings := make(map[string][]string)
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(sc.Text()))
+		if line == "" {
+			continue
+		}
+		if line[0] == '[' {
+			return nil, fmt.Errorf("%s:%d: tables are not supported", path, n)
+		}
+		i := strings.IndexByte(line, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("%s:%d: expected key = value", path, n)
+		}
+		key, value := strings.Trim(strings.TrimSpace(line[:i]), `"`), strings.TrimSpace(line[i+1:])
+		if _, ok := settings[key]; ok {
+			return nil, fmt.Errorf("%s:%d: %s is set twice", path, n, key)
+		}
+		start := n
+		// arrays can span several lines
+		for strings.HasPrefix(value, "[") && !arrayClosed(value) && sc.Scan() {
+			n++
+			value += " " + strings.TrimSpace(stripComment(sc.Text()))
+		}
+		vals, err := parseTOMLValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s: %v", path, start, key, err)
+		}
+		settings[key] = vals
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read config: %v", err)
+	}
+	return settings, nil
+}
+
+// readYAMLConfig reads a YAML file of "flag: value" lines, with the values
+// of the flags that can be repeated given as [a, b] or as a list of "- a"
+// lines. Nested mappings and multi-line strings are not supported.
+func readYAMLConfig(path string) (map[string][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config: %v", err)
+	}
+	defer f.Close()
+	settings := make(map[string][]string)
+	var list string // key of the list being read
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		raw := stripYAMLComment(sc.Text())
+		line := strings.TrimSpace(raw)
+		if line == "" || line == "---" {
+			continue
+		}
+		if line == "-" || strings.HasPrefix(line, "- ") {
+			if list == "" {
+				return nil, fmt.Errorf("%s:%d: list item without a key", path, n)
+			}
+			v, err := parseYAMLScalar(strings.TrimSpace(line[1:]))
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %s: %v", path, n, list, err)
+			}
+			settings[list] = append(settings[list], v)
+			continue
+		}
+		if raw[0] == ' ' || raw[0] == '\t' {
+			return nil, fmt.Errorf("%s:%d: nested mappings are not supported", path, n)
+		}
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			return nil, fmt.Errorf("%s:%d: expected key: value", path, n)
+		}
+		key, value := strings.Trim(strings.TrimSpace(line[:i]), `"'`), strings.TrimSpace(line[i+1:])
+		if _, ok := settings[key]; ok {
+			return nil, fmt.Errorf("%s:%d: %s is set twice", path, n, key)
+		}
+		list = ""
+		switch {
+		case value == "":
+			list = key
+			settings[key] = []string{}
+		case value[0] == '[':
+			vals, err := parseTOMLValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %s: %v", path, n, key, err)
+			}
+			settings[key] = vals
+		default:
+			v, err := parseYAMLScalar(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %s: %v", path, n, key, err)
+			}
+			settings[key] = []string{v}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read config: %v", err)
+	}
+	return settings, nil
+}
+
+// parseYAMLScalar returns a quoted or plain YAML value.
+func parseYAMLScalar(s string) (string, error) {
+	switch {
+	case s == "":
+		return "", errors.New("expected value")
+	case s[0] == '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' {
+			return "", errors.New("unterminated string")
+		}
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	case s[0] == '"':
+		v, rest, err := parseTOMLScalar(s)
+		if err == nil && rest != "" {
+			err = fmt.Errorf("unexpected %q after value", rest)
+		}
+		return v, err
+	}
+	return s, nil
+}
+
+// stripYAMLComment removes a # comment, which in YAML starts a line or
+// follows a space, that is not within a string.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// stripComment removes a # comment that is not within a string.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// arrayClosed reports whether an array value ends on this line.
+func arrayClosed(s string) bool {
+	return strings.HasSuffix(strings.TrimSpace(s), "]")
+}
+
+// parseTOMLValue returns the values of a string, number, boolean or array
+// of them.
+func parseTOMLValue(s string) ([]string, error) {
+	if s == "" {
+		return nil, errors.New("expected value")
+	}
+	if !strings.HasPrefix(s, "[") {
+		v, rest, err := parseTOMLScalar(s)
+		if err != nil {
+			return nil, err
+		}
+		if rest != "" {
+			return nil, fmt.Errorf("unexpected %q after value", rest)
+		}
+		return []string{v}, nil
+	}
+	if !arrayClosed(s) {
+		return nil, errors.New("unterminated array")
+	}
+	s = strings.TrimSpace(s[1 : len(s)-1])
+	vals := []string{}
+	for s != "" {
+		v, rest, err := parseTOMLScalar(s)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+		if rest != "" && rest[0] != ',' {
+			return nil, fmt.Errorf("expected comma before %q", rest)
+		}
+		s = strings.TrimSpace(strings.TrimPrefix(rest, ","))
+	}
+	return vals, nil
+}
+
+// parseTOMLScalar parses the value at the start of s and returns the rest.
+func parseTOMLScalar(s string) (string, string, error) {
+	if s == "" {
+		return "", "", errors.New("expected value")
+	}
+	switch s[0] {
+	case '\'':
+		i := strings.IndexByte(s[1:], '\'')
+		if i < 0 {
+			return "", "", errors.New("unterminated string")
+		}
+		return s[1 : i+1], strings.TrimSpace(s[i+2:]), nil
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			switch c := s[i]; c {
+			case '"':
+				return b.String(), strings.TrimSpace(s[i+1:]), nil
+			case '\\':
+				if i++; i == len(s) {
+					return "", "", errors.New("unterminated string")
+				}
+				switch s[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				case '"', '\\':
+					b.WriteByte(s[i])
+				default:
+					return "", "", fmt.Errorf("unsupported escape \\%c", s[i])
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", "", errors.New("unterminated string")
+	}
+	// numbers and booleans end at a comma or at the end
+	i := strings.IndexByte(s, ',')
+	if i < 0 {
+		i = len(s)
+	}
+	v := strings.TrimSpace(s[:i])
+	if v == "" || strings.ContainsAny(v, " \t[]") {
+		return "", "", fmt.Errorf("invalid value %q", v)
+	}
+	return v, s[i:], nil
+}
+
+// apply sets the flags that were not set otherwise to the values of the
+// file, and records them in fromFile. It returns the errors of all the
+// settings that could not be applied.
+func (c *configFile) apply(set func(name string) bool, fromFile map[string]string) []error {
+	names := make([]string, 0, len(c.settings))
+	for name := range c.settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		f := flag.Lookup(name)
+		if f == nil || name == "config" {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %q", c.sources[name], name))
+			continue
+		}
+		if set(name) {
+			continue
+		}
+		vals := c.settings[name]
+		if _, ok := f.Value.(*stringsFlag); !ok && len(vals) != 1 {
+			errs = append(errs, fmt.Errorf("%s: %s takes a single value", c.sources[name], name))
+			continue
+		}
+		for _, v := range vals {
+			if err := f.Value.Set(v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid value %q for %s: %v", c.sources[name], v, name, err))
+			}
+		}
+		fromFile[name] = c.sources[name]
+	}
+	return errs
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// readSecret returns the content of a file holding a password or token,
+// without the trailing newline.
+func readSecret(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot read secret: %v", err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+type endpointKey struct{}
+
+// forEndpoint returns a context for the requests to the InfluxDB endpoint,
+// which the -token and OAuth transports authenticate whatever the host of
+// the endpoint is, also after it is switched. Requests to other services,
+// like Kapacitor or polled URLs, never get its credentials.
+func forEndpoint(ctx context.Context) context.Context {
+	return context.WithValue(ctx, endpointKey{}, true)
+}
+
+// isForEndpoint reports whether req was made with a forEndpoint context.
+func isForEndpoint(req *http.Request) bool {
+	ok, _ := req.Context().Value(endpointKey{}).(bool)
+	return ok
+}
+
+// secret holds a credential that can be replaced while it is in use.
+type secret struct {
+	v atomic.Value
+}
+
+func newSecret(s string) *secret {
+	sec := &secret{}
+	sec.store(s)
+	return sec
+}
+
+func (s *secret) load() string {
+	return s.v.Load().(string)
+}
+
+func (s *secret) store(v string) {
+	s.v.Store(v)
+}
+
+// watchSecret calls update with the new content of the secret file at path
+// every time the file changes, checked every interval, or on SIGHUP.
+func watchSecret(path string, interval time.Duration, update func(string)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	var modTime time.Time
+	if fi, err := os.Stat(path); err == nil {
+		modTime = fi.ModTime()
+	}
+	for {
+		select {
+		case <-hup:
+		case <-tick.C:
+			fi, err := os.Stat(path)
+			if err != nil || fi.ModTime().Equal(modTime) {
+				continue
+			}
+			modTime = fi.ModTime()
+		}
+		secret, err := readSecret(path)
+		if err != nil {
+			elog.Printf("cannot reload credentials: %v", err)
+			continue
+		}
+		update(secret)
+		ilog.Printf("reloaded credentials from %s", path)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// csvCollector writes the points in the annotated CSV format read by
+// "influx write --format csv". A new table, with its own annotation and
+// header rows, starts every time the columns change.
+type csvCollector struct {
+	w io.Writer
+}
+
+// csvField returns the annotated CSV type and value of a line protocol
+// field value.
+func csvField(v string) (string, string) {
+	switch {
+	case isStringField(v):
+		return "string", fieldString(v)
+	case strings.HasSuffix(v, "i"):
+		return "long", v[:len(v)-1]
+	case strings.HasSuffix(v, "u"):
+		return "unsignedLong", v[:len(v)-1]
+	}
+	switch v {
+	case "t", "T", "true", "True", "TRUE":
+		return "boolean", "true"
+	case "f", "F", "false", "False", "FALSE":
+		return "boolean", "false"
+	}
+	return "double", v
+}
+
+func (c csvCollector) collect(ctx context.Context, ch <-chan string) {
+	w := csv.NewWriter(c.w)
+	var layout string
+	for {
+		var line string
+		select {
+		case l, ok := <-ch:
+			if !ok {
+				return
+			}
+			line = l
+		case <-ctx.Done():
+			return
+		}
+		p, err := parsePoint(line)
+		if err != nil {
+			dlog.Printf("cannot parse %q, not writing as CSV: %v", line, err)
+			continue
+		}
+		types := []string{"measurement"}
+		names := []string{"measurement"}
+		values := []string{p.measurement}
+		for _, t := range p.tags {
+			types = append(types, "tag")
+			names = append(names, t.key)
+			values = append(values, t.value)
+		}
+		for _, f := range p.fields {
+			typ, v := csvField(f.value)
+			types = append(types, typ)
+			names = append(names, f.key)
+			values = append(values, v)
+		}
+		if p.hasTime {
+			types = append(types, "dateTime:number")
+			names = append(names, "time")
+			values = append(values, strconv.FormatInt(p.time, 10))
+		}
+		if l := strings.Join(types, ",") + "\n" + strings.Join(names, ","); l != layout {
+			if layout != "" {
+				w.Flush()
+				io.WriteString(c.w, "\n")
+			}
+			layout = l
+			types[0] = "#datatype " + types[0]
+			w.Write(types)
+			w.Write(names)
+		}
+		w.Write(values)
+		w.Flush()
+		if err := w.Error(); err != nil {
+			elog.Printf("cannot write CSV: %v", err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+type dedupEntry struct {
+	hash uint64
+	seen time.Time
+}
+
+// dedupTransform drops points that are exact duplicates of a point seen
+// within the window. At most size points are remembered.
+type dedupTransform struct {
+	window time.Duration
+	size   int
+
+	mux   sync.Mutex
+	seen  map[uint64]time.Time
+	order []dedupEntry // oldest first
+}
+
+func newDedupTransform(window time.Duration, size int) (*dedupTransform, error) {
+	if size <= 0 {
+		return nil, errors.New("-dedup-size must be positive")
+	}
+	return &dedupTransform{
+		window: window,
+		size:   size,
+		seen:   make(map[uint64]time.Time),
+	}, nil
+}
+
+func (d *dedupTransform) String() string {
+	return fmt.Sprintf("drop duplicates within %v", d.window)
+}
+
+func (d *dedupTransform) apply(p *point) bool {
+	h := fnv.New64a()
+	h.Write([]byte(p.String()))
+	sum := h.Sum64()
+	now := time.Now()
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	for len(d.order) > 0 && (len(d.order) >= d.size || now.Sub(d.order[0].seen) >= d.window) {
+		e := d.order[0]
+		if d.seen[e.hash] == e.seen {
+			delete(d.seen, e.hash)
+		}
+		d.order = d.order[1:]
+	}
+	if _, ok := d.seen[sum]; ok {
+		return false
+	}
+	d.seen[sum] = now
+	d.order = append(d.order, dedupEntry{sum, now})
+	return true
+}
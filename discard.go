@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"sync/atomic"
+	"time"
+)
+
+// discardCounts counts the batches dropped instead of being sent, with
+// -sink=discard. Fields are updated atomically.
+type discardCounts struct {
+	batches int64
+	lines   int64
+	bytes   int64
+}
+
+func (s *submitter) discardBatch(b []byte) {
+	lines := int64(bytes.Count(b, []byte{'\n'}))
+	atomic.AddInt64(&s.discarded.batches, 1)
+	atomic.AddInt64(&s.discarded.lines, lines)
+	atomic.AddInt64(&s.discarded.bytes, int64(len(b)))
+	stats.Add("discarded_batches", 1)
+	stats.Add("discarded_lines", lines)
+	stats.Add("discarded_bytes", int64(len(b)))
+}
+
+// reportDiscarded logs the throughput of discarded batches every period.
+func (s *submitter) reportDiscarded(every time.Duration) {
+	var last discardCounts
+	for range time.Tick(every) {
+		cur := discardCounts{
+			batches: atomic.LoadInt64(&s.discarded.batches),
+			lines:   atomic.LoadInt64(&s.discarded.lines),
+			bytes:   atomic.LoadInt64(&s.discarded.bytes),
+		}
+		secs := every.Seconds()
+		ilog.Printf("discarded %.1f lines/s, %.1f batches/s, %.1f KiB/s",
+			float64(cur.lines-last.lines)/secs, float64(cur.batches-last.batches)/secs, float64(cur.bytes-last.bytes)/secs/1024)
+		last = cur
+	}
+}
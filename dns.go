@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// failoverDialer resolves the host at every connection and tries its
+// addresses starting from the last one that worked, moving on to the next
+// ones when connecting fails.
+type failoverDialer struct {
+	dialer net.Dialer
+
+	mux  sync.Mutex
+	next map[string]int // host to index of the address to try first
+}
+
+func newFailoverDialer(timeout time.Duration) *failoverDialer {
+	return &failoverDialer{
+		dialer: net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second},
+		next:   make(map[string]int),
+	}
+}
+
+func (d *failoverDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	d.mux.Lock()
+	start := d.next[host]
+	d.mux.Unlock()
+	for i := range addrs {
+		n := (start + i) % len(addrs)
+		conn, cerr := d.dialer.DialContext(ctx, network, net.JoinHostPort(addrs[n], port))
+		if cerr == nil {
+			d.mux.Lock()
+			d.next[host] = n
+			d.mux.Unlock()
+			return conn, nil
+		}
+		dlog.Printf("cannot connect to %s (%s), trying next address: %v", host, addrs[n], cerr)
+		err = cerr
+	}
+	return nil, err
+}
+
+// refreshConnections periodically closes the idle connections of t, so
+// that new connections are made to freshly resolved addresses.
+func refreshConnections(t *hostTransport, interval time.Duration) {
+	for range time.Tick(interval) {
+		t.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"time"
+)
+
+// downsampleGrace is how long after the end of a window points for it are
+// still accepted, before its means are written.
+const downsampleGrace = 10 * time.Second
+
+// downsampler is a collector that computes the mean of the numeric fields
+// of each series over fixed windows, and submits one point per series and
+// window, timestamped at the start of the window. String and boolean
+// fields are ignored.
+type downsampler struct {
+	every     time.Duration
+	unit      time.Duration // of timestamps
+	submitter *submitter
+	windows   map[int64]map[string]*means // by window start, then series
+	written   int64                       // end of the last window written
+}
+
+// means accumulates the fields of a series in a window.
+type means struct {
+	p      *point
+	sums   map[string]float64
+	counts map[string]int
+	order  []string // field names in order of appearance
+}
+
+func newDownsampler(every, unit time.Duration, sub *submitter) *downsampler {
+	return &downsampler{
+		every:     every,
+		unit:      unit,
+		submitter: sub,
+		windows:   make(map[int64]map[string]*means),
+	}
+}
+
+func (d *downsampler) collect(ctx context.Context, ch <-chan string) {
+	tick := time.NewTicker(clk.wait(downsampleGrace))
+	defer tick.Stop()
+	for {
+		select {
+		case line := <-ch:
+			d.add(line)
+		case <-tick.C:
+			d.flush(skew.now().Add(-downsampleGrace).UnixNano())
+		case <-ctx.Done():
+			// partial windows are better than none
+			d.flush(1<<63 - 1)
+			return
+		}
+	}
+}
+
+func (d *downsampler) add(line string) {
+	p, err := parsePoint(line)
+	if err != nil {
+		return
+	}
+	t := skew.now().UnixNano()
+	if p.hasTime {
+		t = p.time * int64(d.unit)
+	}
+	start := t - t%int64(d.every)
+	if start < d.written {
+		stats.Add("downsample_late", 1)
+		return
+	}
+	w, ok := d.windows[start]
+	if !ok {
+		w = make(map[string]*means)
+		d.windows[start] = w
+	}
+	var m *means
+	for _, f := range p.fields {
+		v, ok := fieldFloat(f.value)
+		if !ok {
+			continue
+		}
+		if m == nil {
+			key := seriesKey(p)
+			if m, ok = w[key]; !ok {
+				m = &means{
+					p:      &point{measurement: p.measurement, tags: p.tags},
+					sums:   make(map[string]float64),
+					counts: make(map[string]int),
+				}
+				w[key] = m
+			}
+		}
+		if _, ok := m.counts[f.key]; !ok {
+			m.order = append(m.order, f.key)
+		}
+		m.sums[f.key] += v
+		m.counts[f.key]++
+	}
+}
+
+// flush submits the windows ending before the nanosecond timestamp until.
+func (d *downsampler) flush(until int64) {
+	var starts []int64
+	for start := range d.windows {
+		if start+int64(d.every) <= until {
+			starts = append(starts, start)
+		}
+	}
+	if len(starts) == 0 {
+		return
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	var buf bytes.Buffer
+	for _, start := range starts {
+		w := d.windows[start]
+		keys := make([]string, 0, len(w))
+		for k := range w {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			m := w[k]
+			for _, f := range m.order {
+				m.p.setField(f, formatFloat(m.sums[f]/float64(m.counts[f])))
+			}
+			m.p.time, m.p.hasTime = start/int64(d.unit), true
+			buf.WriteString(m.p.String())
+			buf.WriteByte('\n')
+		}
+		delete(d.windows, start)
+		if end := start + int64(d.every); end > d.written {
+			d.written = end
+		}
+	}
+	if buf.Len() > 0 {
+		d.submitter.submit(buf.Bytes())
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"expvar"
+	"net"
+	"strings"
+)
+
+// errorClasses are the kinds of submission failures that are counted
+// separately, to tell what to fix.
+var errorClasses = []string{"dns", "connect", "tls", "timeout", "4xx", "5xx", "other"}
+
+// submitErrors counts the failed requests to the endpoints by class.
+var submitErrors = new(expvar.Map).Init()
+
+func init() {
+	for _, c := range errorClasses {
+		submitErrors.Add(c, 0)
+	}
+	stats.Set("submit_errors", submitErrors)
+}
+
+// classifyError returns the class of the error of a request.
+func classifyError(err error) string {
+	var (
+		serr   *statusError
+		dnsErr *net.DNSError
+		opErr  *net.OpError
+		nerr   net.Error
+	)
+	switch {
+	case errors.As(err, &serr):
+		if serr.code >= 500 {
+			return "5xx"
+		}
+		if serr.code >= 400 {
+			return "4xx"
+		}
+		return "other"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case isTLSError(err):
+		return "tls"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &nerr) && nerr.Timeout():
+		return "timeout"
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return "connect"
+	}
+	return "other"
+}
+
+func isTLSError(err error) bool {
+	var (
+		unknownAuth x509.UnknownAuthorityError
+		hostname    x509.HostnameError
+		invalid     x509.CertificateInvalidError
+		header      tls.RecordHeaderError
+	)
+	if errors.As(err, &unknownAuth) || errors.As(err, &hostname) || errors.As(err, &invalid) || errors.As(err, &header) {
+		return true
+	}
+	// handshake failures reported by the peer have no exported type
+	return strings.Contains(err.Error(), "tls: ")
+}
+
+// countSubmitError accounts a failed request to the endpoint host in the
+// totals and in the metrics of the host, and returns its class.
+func countSubmitError(es *expvar.Map, err error) string {
+	class := classifyError(err)
+	submitErrors.Add(class, 1)
+	es.Add("errors_"+class, 1)
+	return class
+}
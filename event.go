@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// eventPoint returns a point for a one-off event, like a deployment. Tags
+// and fields are given as key=value; field values that are numbers or
+// booleans keep their type, anything else is written as a string, with
+// the escaping line protocol requires. A value in double quotes is always
+// a string.
+func eventPoint(measurement string, tags, fields []string, t time.Time, unit time.Duration) (*point, error) {
+	if measurement == "" {
+		return nil, errors.New("missing measurement")
+	}
+	p := &point{measurement: measurement}
+	for _, kv := range tags {
+		i := strings.IndexByte(kv, '=')
+		if i <= 0 || i == len(kv)-1 {
+			return nil, fmt.Errorf("invalid tag %q: use key=value", kv)
+		}
+		p.setTag(kv[:i], kv[i+1:])
+	}
+	for _, kv := range fields {
+		i := strings.IndexByte(kv, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid field %q: use key=value", kv)
+		}
+		p.setField(kv[:i], eventValue(kv[i+1:]))
+	}
+	if len(p.fields) == 0 {
+		return nil, errors.New("an event needs at least one field")
+	}
+	p.time, p.hasTime = t.UnixNano()/int64(unit), true
+	return p, nil
+}
+
+// eventValue returns v as a line protocol field value.
+func eventValue(v string) string {
+	if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		return quoteField(v[1 : len(v)-1])
+	}
+	if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return v + "i"
+	}
+	if f, err := strconv.ParseFloat(v, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+		return v
+	}
+	if v == "true" || v == "false" {
+		return v
+	}
+	return quoteField(v)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+)
+
+// eventLevels are the names of the standard Windows event levels.
+var eventLevels = map[string]string{
+	"0": "information", // LogAlways, used by classic event sources
+	"1": "critical",
+	"2": "error",
+	"3": "warning",
+	"4": "information",
+	"5": "verbose",
+}
+
+// eventXML holds the fields of a rendered event that become tags.
+type eventXML struct {
+	System struct {
+		Provider struct {
+			Name string `xml:"Name,attr"`
+		}
+		EventID string
+		Level   string
+		Channel string
+	}
+}
+
+// eventLogPoint converts a Windows event, rendered as XML, to a point.
+func eventLogPoint(raw []byte) (*point, error) {
+	var ev eventXML
+	if err := xml.Unmarshal(raw, &ev); err != nil {
+		return nil, err
+	}
+	p := &point{measurement: "win_eventlog"}
+	for _, t := range []tag{
+		{"channel", ev.System.Channel},
+		{"provider", ev.System.Provider.Name},
+		{"event_id", ev.System.EventID},
+		{"level", eventLevels[ev.System.Level]},
+	} {
+		if t.value != "" {
+			p.setTag(t.key, t.value)
+		}
+	}
+	p.setField("count", "1i")
+	return p, nil
+}
+
+// newEventLogInput subscribes to the events of a channel, matching an
+// optional XPath query, given as CHANNEL[:XPATH].
+func newEventLogInput(arg string) (input, error) {
+	if arg == "" {
+		return nil, errors.New("input eventlog requires a channel, like eventlog:System or eventlog:Application:*[System[Level<=3]]")
+	}
+	channel, query := arg, "*"
+	if i := strings.IndexByte(arg, ':'); i >= 0 {
+		channel, query = arg[:i], arg[i+1:]
+	}
+	return newEventLogSubscription(channel, query)
+}
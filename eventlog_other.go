@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+func newEventLogSubscription(channel, query string) (input, error) {
+	return nil, errors.New("the event log is only available on Windows")
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	wevtapi                  = syscall.NewLazyDLL("wevtapi.dll")
+	evtSubscribe             = wevtapi.NewProc("EvtSubscribe")
+	evtNext                  = wevtapi.NewProc("EvtNext")
+	evtRender                = wevtapi.NewProc("EvtRender")
+	evtOpenPublisherMetadata = wevtapi.NewProc("EvtOpenPublisherMetadata")
+	evtFormatMessage         = wevtapi.NewProc("EvtFormatMessage")
+	evtClose                 = wevtapi.NewProc("EvtClose")
+	createEvent              = syscall.NewLazyDLL("kernel32.dll").NewProc("CreateEventW")
+)
+
+const (
+	evtSubscribeToFutureEvents = 1
+	evtRenderEventXML          = 1
+	evtFormatMessageEvent      = 1
+	errorNoMoreItems           = 259
+	errorInsufficientBuffer    = 122
+)
+
+// eventLogSubscription receives the new events of a channel matching an
+// XPath query.
+type eventLogSubscription struct {
+	channel, query string
+}
+
+func newEventLogSubscription(channel, query string) (input, error) {
+	if err := wevtapi.Load(); err != nil {
+		return nil, fmt.Errorf("cannot load wevtapi.dll: %v", err)
+	}
+	return eventLogSubscription{channel: channel, query: query}, nil
+}
+
+func (s eventLogSubscription) String() string {
+	return "event log " + s.channel + " matching " + s.query
+}
+
+func (s eventLogSubscription) run(ctx context.Context, rs *results) error {
+	signal, _, err := createEvent.Call(0, 0, 1, 0)
+	if signal == 0 {
+		return fmt.Errorf("cannot create event: %v", err)
+	}
+	defer syscall.CloseHandle(syscall.Handle(signal))
+	channel, err := syscall.UTF16PtrFromString(s.channel)
+	if err != nil {
+		return err
+	}
+	query, err := syscall.UTF16PtrFromString(s.query)
+	if err != nil {
+		return err
+	}
+	sub, _, err := evtSubscribe.Call(0, signal, uintptr(unsafe.Pointer(channel)), uintptr(unsafe.Pointer(query)), 0, 0, 0, evtSubscribeToFutureEvents)
+	if sub == 0 {
+		return fmt.Errorf("cannot subscribe to %s: %v", s.channel, err)
+	}
+	defer evtClose.Call(sub)
+	ch := make(chan string)
+	defer close(ch)
+	go rs.collect(ch)
+	publishers := make(map[string]uintptr)
+	defer func() {
+		for _, h := range publishers {
+			evtClose.Call(h)
+		}
+	}()
+	for ctx.Err() == nil {
+		ev, err := syscall.WaitForSingleObject(syscall.Handle(signal), 1000)
+		if err != nil {
+			return err
+		}
+		if ev != syscall.WAIT_OBJECT_0 {
+			continue
+		}
+		for {
+			var (
+				events   [16]uintptr
+				returned uint32
+			)
+			ok, _, err := evtNext.Call(sub, uintptr(len(events)), uintptr(unsafe.Pointer(&events[0])), 0, 0, uintptr(unsafe.Pointer(&returned)))
+			if ok == 0 {
+				if errno, _ := err.(syscall.Errno); errno != errorNoMoreItems {
+					elog.Printf("reading events of %s: %v", s.channel, err)
+				}
+				break
+			}
+			for _, e := range events[:returned] {
+				if line, err := s.convert(e, publishers); err != nil {
+					elog.Printf("converting event of %s: %v", s.channel, err)
+				} else {
+					select {
+					case ch <- line:
+					case <-ctx.Done():
+					}
+				}
+				evtClose.Call(e)
+			}
+		}
+	}
+	return nil
+}
+
+func (s eventLogSubscription) convert(event uintptr, publishers map[string]uintptr) (string, error) {
+	raw, err := renderEvent(event)
+	if err != nil {
+		return "", err
+	}
+	p, err := eventLogPoint(raw)
+	if err != nil {
+		return "", err
+	}
+	if name, ok := p.tag("provider"); ok {
+		h, ok := publishers[name]
+		if !ok {
+			if n, err := syscall.UTF16PtrFromString(name); err == nil {
+				h, _, _ = evtOpenPublisherMetadata.Call(0, uintptr(unsafe.Pointer(n)), 0, 0, 0)
+			}
+			publishers[name] = h
+		}
+		if msg := strings.TrimSpace(formatEventMessage(h, event)); msg != "" {
+			p.setField("message", quoteField(msg))
+		}
+	}
+	return p.String(), nil
+}
+
+// renderEvent returns the event as UTF-8 XML.
+func renderEvent(event uintptr) ([]byte, error) {
+	var used, props uint32
+	buf := make([]uint16, 4096)
+	for {
+		ok, _, err := evtRender.Call(0, event, evtRenderEventXML, uintptr(len(buf)*2), uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&used)), uintptr(unsafe.Pointer(&props)))
+		if ok != 0 {
+			return []byte(syscall.UTF16ToString(buf[:used/2])), nil
+		}
+		if errno, _ := err.(syscall.Errno); errno != errorInsufficientBuffer {
+			return nil, fmt.Errorf("cannot render event: %v", err)
+		}
+		buf = make([]uint16, used/2+1)
+	}
+}
+
+// formatEventMessage returns the message of the event in the language of
+// the system, or an empty string if the publisher does not provide it.
+func formatEventMessage(publisher, event uintptr) string {
+	if publisher == 0 {
+		return ""
+	}
+	var used uint32
+	buf := make([]uint16, 1024)
+	for {
+		ok, _, err := evtFormatMessage.Call(publisher, event, 0, 0, 0, evtFormatMessageEvent, uintptr(len(buf)), uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&used)))
+		if ok != 0 {
+			return syscall.UTF16ToString(buf[:used])
+		}
+		if errno, _ := err.(syscall.Errno); errno != errorInsufficientBuffer {
+			return ""
+		}
+		buf = make([]uint16, used)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+)
+
+// execdCollector writes measurements to standard output for a Telegraf
+// execd input. Unless signal is "none", measurements are held until
+// Telegraf asks for them with the configured signal.
+type execdCollector struct {
+	w       io.Writer
+	trigger chan struct{} // nil to write immediately
+}
+
+// execdSignals lists the values of the signal option of Telegraf execd.
+func execdSignals() []string {
+	var ss []string
+	for name := range execdOSSignals {
+		ss = append(ss, name)
+	}
+	sort.Strings(ss)
+	return append([]string{"none", "STDIN"}, ss...)
+}
+
+// newExecdCollector returns a collector for the execd signal option.
+// Telegraf closes the standard input to stop the plugin, so stop is called
+// when it ends to shut influxin down, unless readStdin is false because the
+// commands use it.
+func newExecdCollector(w io.Writer, sig string, readStdin bool, stop func()) (*execdCollector, error) {
+	e := &execdCollector{w: w}
+	if sig != "none" {
+		e.trigger = make(chan struct{}, 1)
+	}
+	switch sig {
+	case "none", "STDIN":
+	default:
+		s, ok := execdOSSignals[sig]
+		if !ok {
+			return nil, fmt.Errorf("invalid execd signal %q, use one of: %s", sig, strings.Join(execdSignals(), ", "))
+		}
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, s)
+		go func() {
+			for range ch {
+				e.collectNow()
+			}
+		}()
+	}
+	if sig == "STDIN" && !readStdin {
+		return nil, fmt.Errorf("execd signal STDIN cannot be used when the commands read influxin's standard input")
+	}
+	if readStdin {
+		go func() {
+			sc := bufio.NewScanner(os.Stdin)
+			for sc.Scan() {
+				if sig == "STDIN" {
+					e.collectNow()
+				}
+			}
+			ilog.Printf("standard input closed, exiting")
+			stop()
+		}()
+	}
+	return e, nil
+}
+
+func (e *execdCollector) collectNow() {
+	select {
+	case e.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (e *execdCollector) String() string {
+	return "Telegraf execd on " + writerName(e.w)
+}
+
+func (e *execdCollector) collect(ctx context.Context, ch <-chan string) {
+	var buf bytes.Buffer
+	flush := func() {
+		if _, err := e.w.Write(buf.Bytes()); err != nil {
+			elog.Printf("cannot write measurements: %v", err)
+		}
+		buf.Reset()
+	}
+	for {
+		select {
+		case r, ok := <-ch:
+			if !ok {
+				flush()
+				return
+			}
+			buf.WriteString(r)
+			buf.WriteByte('\n')
+			if e.trigger == nil {
+				flush()
+			}
+		case <-e.trigger:
+			flush()
+		case <-ctx.Done():
+			flush()
+			return
+		}
+	}
+}
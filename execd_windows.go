@@ -0,0 +1,6 @@
+package main
+
+import "os"
+
+// execdOSSignals is empty: Telegraf execd only supports STDIN on Windows.
+var execdOSSignals = map[string]os.Signal{}
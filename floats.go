@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// floatTransform rounds float fields to a number of significant digits and
+// handles NaN and infinite values, which InfluxDB rejects: they are either
+// kept, dropped or clamped to the largest finite float. Points left
+// without fields are dropped.
+type floatTransform struct {
+	digits    int
+	nonFinite string
+}
+
+func newFloatTransform(digits int, nonFinite string) (*floatTransform, error) {
+	switch nonFinite {
+	case "keep", "drop", "clamp":
+	default:
+		return nil, fmt.Errorf("invalid handling of non finite values %q: use keep, drop or clamp", nonFinite)
+	}
+	return &floatTransform{digits: digits, nonFinite: nonFinite}, nil
+}
+
+func (t *floatTransform) String() string {
+	return fmt.Sprintf("round floats to %d digits, %s non finite values", t.digits, t.nonFinite)
+}
+
+// floatField returns the value of a float field value.
+func floatField(v string) (float64, bool) {
+	if isStringField(v) || strings.HasSuffix(v, "i") || strings.HasSuffix(v, "u") {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	return f, err == nil
+}
+
+func (t *floatTransform) apply(p *point) bool {
+	fields := p.fields[:0]
+	for _, f := range p.fields {
+		v, ok := floatField(f.value)
+		if !ok {
+			fields = append(fields, f)
+			continue
+		}
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			switch {
+			case t.nonFinite == "drop" || (t.nonFinite == "clamp" && math.IsNaN(v)):
+				continue
+			case t.nonFinite == "clamp":
+				v = math.Copysign(math.MaxFloat64, v)
+				f.value = strconv.FormatFloat(v, 'g', -1, 64)
+			}
+			fields = append(fields, f)
+			continue
+		}
+		if t.digits > 0 {
+			v, _ = strconv.ParseFloat(strconv.FormatFloat(v, 'g', t.digits, 64), 64)
+			f.value = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		fields = append(fields, f)
+	}
+	p.fields = fields
+	return len(p.fields) > 0
+}
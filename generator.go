@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// generator produces synthetic measurements spread over a fixed number of
+// series, with values following a distribution.
+type generator struct {
+	measurement string
+	series      int
+	value       func() float64
+	rnd         *rand.Rand
+}
+
+func newGenerator(measurement string, series int, dist string) (*generator, error) {
+	if series <= 0 {
+		return nil, errors.New("the number of series must be positive")
+	}
+	g := &generator{
+		measurement: measurement,
+		series:      series,
+		rnd:         rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	switch dist {
+	case "uniform":
+		g.value = g.rnd.Float64
+	case "normal":
+		g.value = g.rnd.NormFloat64
+	case "exponential":
+		g.value = g.rnd.ExpFloat64
+	default:
+		return nil, fmt.Errorf("unknown distribution %q", dist)
+	}
+	return g, nil
+}
+
+func (g *generator) next(t time.Time) string {
+	return fmt.Sprintf("%s,series=s%d value=%f %d", g.measurement, g.rnd.Intn(g.series), g.value(), t.UnixNano())
+}
+
+// run sends rate measurements per second to ch until ctx is done, then
+// closes ch.
+func (g *generator) run(ctx context.Context, rate int, ch chan<- string) {
+	defer close(ch)
+	const interval = 10 * time.Millisecond
+	var due float64
+	perTick := float64(rate) * interval.Seconds()
+	tick := time.NewTicker(clk.wait(interval))
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+		due += perTick
+		for now := clk.now(); due >= 1; due-- {
+			ch <- g.next(now)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// mmdbMarker starts the metadata at the end of a MaxMind database.
+var mmdbMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// mmdb is a MaxMind database, like GeoLite2-Country or GeoLite2-ASN: a
+// binary tree on the bits of the addresses whose leaves point to records
+// in the data section.
+type mmdb struct {
+	buf        []byte
+	nodes      uint
+	recordSize uint
+	ipv6       bool
+	data       []byte
+	ipv4Start  uint // node reached after the 96 zero bits of IPv4 addresses
+}
+
+func readMMDB(file string) (*mmdb, error) {
+	buf, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	i := bytes.LastIndex(buf, mmdbMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("%s: not a MaxMind database", file)
+	}
+	meta := buf[i+len(mmdbMarker):]
+	v, _, err := decodeMMDB(meta, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid metadata: %v", file, err)
+	}
+	m, _ := v.(map[string]interface{})
+	nodes, _ := m["node_count"].(uint64)
+	size, _ := m["record_size"].(uint64)
+	version, _ := m["ip_version"].(uint64)
+	if size != 24 && size != 28 && size != 32 {
+		return nil, fmt.Errorf("%s: unsupported record size %d", file, size)
+	}
+	tree := nodes * size / 4
+	if tree+16 > uint64(i) {
+		return nil, fmt.Errorf("%s: truncated search tree", file)
+	}
+	db := &mmdb{
+		buf:        buf[:tree],
+		nodes:      uint(nodes),
+		recordSize: uint(size),
+		ipv6:       version == 6,
+		data:       buf[tree+16 : i],
+	}
+	if db.ipv6 {
+		for n := 0; n < 96 && db.ipv4Start < db.nodes; n++ {
+			db.ipv4Start = db.record(db.ipv4Start, 0)
+		}
+	}
+	return db, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node.
+func (db *mmdb) record(node, bit uint) uint {
+	switch db.recordSize {
+	case 24:
+		b := db.buf[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := db.buf[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(db.buf[node*8+bit*4:]))
+	}
+}
+
+// lookup returns the record of ip, or nil if the database has none.
+func (db *mmdb) lookup(ip net.IP) (map[string]interface{}, error) {
+	node := uint(0)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, node = ip4, db.ipv4Start
+	} else if !db.ipv6 {
+		return nil, nil
+	}
+	for i := 0; i < len(ip)*8 && node < db.nodes; i++ {
+		node = db.record(node, uint(ip[i/8]>>(7-uint(i%8))&1))
+	}
+	if node <= db.nodes {
+		return nil, nil
+	}
+	v, _, err := decodeMMDB(db.data, node-db.nodes-16)
+	if err != nil {
+		return nil, err
+	}
+	m, _ := v.(map[string]interface{})
+	return m, nil
+}
+
+// decodeMMDB decodes the value at offset of the data section b and returns
+// it with the offset that follows it.
+func decodeMMDB(b []byte, offset uint) (interface{}, uint, error) {
+	next := func(n uint) ([]byte, error) {
+		if offset+n > uint(len(b)) {
+			return nil, errors.New("unexpected end of data")
+		}
+		p := b[offset : offset+n]
+		offset += n
+		return p, nil
+	}
+	p, err := next(1)
+	if err != nil {
+		return nil, 0, err
+	}
+	ctrl := p[0]
+	kind := uint(ctrl >> 5)
+	if kind == 1 {
+		// pointer to a value elsewhere in the data section
+		n := uint(ctrl>>3&3) + 1
+		p, err := next(n)
+		if err != nil {
+			return nil, 0, err
+		}
+		ptr := uint(ctrl & 7)
+		if n == 4 {
+			ptr = 0
+		}
+		for _, c := range p {
+			ptr = ptr<<8 | uint(c)
+		}
+		ptr += [...]uint{0, 2048, 526336, 0}[n-1]
+		v, _, err := decodeMMDB(b, ptr)
+		return v, offset, err
+	}
+	if kind == 0 {
+		if p, err = next(1); err != nil {
+			return nil, 0, err
+		}
+		kind = 7 + uint(p[0])
+	}
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if p, err = next(n); err != nil {
+			return nil, 0, err
+		}
+		size = [...]uint{29, 285, 65821}[n-1]
+		var extra uint
+		for _, c := range p {
+			extra = extra<<8 | uint(c)
+		}
+		size += extra
+	}
+	switch kind {
+	case 7: // map
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			k, o, err := decodeMMDB(b, offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			v, o, err := decodeMMDB(b, o)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, _ := k.(string)
+			m[key], offset = v, o
+		}
+		return m, offset, nil
+	case 11: // array
+		a := make([]interface{}, size)
+		for i := range a {
+			v, o, err := decodeMMDB(b, offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			a[i], offset = v, o
+		}
+		return a, offset, nil
+	case 14: // boolean, in the size
+		return size != 0, offset, nil
+	}
+	if p, err = next(size); err != nil {
+		return nil, 0, err
+	}
+	switch kind {
+	case 2: // string
+		return string(p), offset, nil
+	case 3: // double
+		if size != 8 {
+			return nil, 0, errors.New("invalid double")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(p)), offset, nil
+	case 15: // float
+		if size != 4 {
+			return nil, 0, errors.New("invalid float")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(p))), offset, nil
+	case 5, 6, 9, 10: // unsigned integers, uint128 truncated
+		var n uint64
+		for _, c := range p {
+			n = n<<8 | uint64(c)
+		}
+		return n, offset, nil
+	case 8: // int32
+		var n uint32
+		for _, c := range p {
+			n = n<<8 | uint32(c)
+		}
+		return int64(int32(n)), offset, nil
+	default: // bytes and the containers that are not used in records
+		return p, offset, nil
+	}
+}
+
+// mmdbString returns the string at the path of keys in a record.
+func mmdbString(v interface{}, keys ...string) string {
+	for _, k := range keys {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		v = m[k]
+	}
+	switch v := v.(type) {
+	case string:
+		return v
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	}
+	return ""
+}
+
+// geoipTransform adds to the measurements with an IP address in one of
+// tags the country, city and autonomous system of the address found in
+// the MaxMind databases, as tags named TAG_country, TAG_city, TAG_asn and
+// TAG_as_org. The databases are reloaded when they change.
+type geoipTransform struct {
+	files []string
+	tags  []string
+	dbs   atomic.Value // []*mmdb
+}
+
+func newGeoipTransform(files, tags []string) (*geoipTransform, error) {
+	g := &geoipTransform{files: files, tags: tags}
+	dbs, err := g.read()
+	if err != nil {
+		return nil, err
+	}
+	g.dbs.Store(dbs)
+	return g, nil
+}
+
+func (g *geoipTransform) read() ([]*mmdb, error) {
+	var dbs []*mmdb
+	for _, f := range g.files {
+		db, err := readMMDB(f)
+		if err != nil {
+			return nil, err
+		}
+		dbs = append(dbs, db)
+	}
+	return dbs, nil
+}
+
+func (g *geoipTransform) String() string {
+	return fmt.Sprintf("add the location of tags %s from %s", strings.Join(g.tags, ", "), strings.Join(g.files, ", "))
+}
+
+func (g *geoipTransform) apply(p *point) bool {
+	for _, t := range g.tags {
+		s, ok := p.tag(t)
+		if !ok {
+			continue
+		}
+		ip := net.ParseIP(s)
+		if ip == nil {
+			continue
+		}
+		for _, db := range g.dbs.Load().([]*mmdb) {
+			r, err := db.lookup(ip)
+			if err != nil {
+				dlog.Printf("cannot look up %s: %v", s, err)
+				continue
+			}
+			country := mmdbString(r, "country", "iso_code")
+			if country == "" {
+				country = mmdbString(r, "registered_country", "iso_code")
+			}
+			for suffix, v := range map[string]string{
+				"_country": country,
+				"_city":    mmdbString(r, "city", "names", "en"),
+				"_asn":     mmdbString(r, "autonomous_system_number"),
+				"_as_org":  mmdbString(r, "autonomous_system_organization"),
+			} {
+				if v != "" {
+					p.setTag(t+suffix, v)
+				}
+			}
+		}
+	}
+	return true
+}
+
+// watch reloads the databases when the modification time of one of them
+// changes. Databases that cannot be read are logged and the previous ones
+// are kept.
+func (g *geoipTransform) watch(ctx context.Context, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	modTimes := make([]time.Time, len(g.files))
+	for i, f := range g.files {
+		if fi, err := os.Stat(f); err == nil {
+			modTimes[i] = fi.ModTime()
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		changed := false
+		for i, f := range g.files {
+			if fi, err := os.Stat(f); err == nil && !fi.ModTime().Equal(modTimes[i]) {
+				modTimes[i], changed = fi.ModTime(), true
+			}
+		}
+		if !changed {
+			continue
+		}
+		dbs, err := g.read()
+		if err != nil {
+			elog.Printf("cannot reload GeoIP databases, keeping the previous ones: %v", err)
+			continue
+		}
+		g.dbs.Store(dbs)
+		ilog.Printf("reloaded GeoIP databases %s", strings.Join(g.files, ", "))
+	}
+}
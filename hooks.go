@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// healthyAfter is how long a command must run, if it does not exit
+// successfully, to be considered recovered.
+const healthyAfter = time.Minute
+
+// hooks are shell commands run when a command fails several times in a
+// row, and when it recovers afterwards.
+type hooks struct {
+	onFailure string
+	onRecover string
+	after     int // consecutive failures that trigger onFailure
+	env       []string
+}
+
+// cmdHealth tracks the consecutive failures of a command.
+type cmdHealth struct {
+	hooks    *hooks
+	name     string
+	mux      sync.Mutex
+	failures int
+	failing  bool // onFailure has run, onRecover has not yet
+}
+
+func (h *hooks) track(name string) *cmdHealth {
+	return &cmdHealth{hooks: h, name: name}
+}
+
+// started is called when the command starts. The returned function must
+// be called when it stops.
+func (c *cmdHealth) started() func() bool {
+	return time.AfterFunc(clk.wait(healthyAfter), c.recovered).Stop
+}
+
+// stopped is called with the result of each execution of the command.
+func (c *cmdHealth) stopped(err error) {
+	if err == nil {
+		c.recovered()
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.failures++
+	if c.failures >= c.hooks.after && !c.failing {
+		c.failing = true
+		go c.hooks.run(c.hooks.onFailure, c.name, c.failures, err.Error())
+	}
+}
+
+func (c *cmdHealth) recovered() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.failures = 0
+	if c.failing {
+		c.failing = false
+		go c.hooks.run(c.hooks.onRecover, c.name, 0, "")
+	}
+}
+
+// run runs the hook line with the shell of the system. The command, its
+// failures and the last error are passed in the environment.
+func (h *hooks) run(line, name string, failures int, lastErr string) {
+	if line == "" {
+		return
+	}
+	shell := "sh"
+	if runtime.GOOS == "windows" {
+		shell = "cmd"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	c, err := shellCommand(ctx, shell, line)
+	if err != nil {
+		elog.Printf("cannot run hook for %s: %v", name, err)
+		return
+	}
+	c.Env = append(append([]string(nil), h.env...),
+		"INFLUXIN_HOOK_COMMAND="+name,
+		"INFLUXIN_HOOK_FAILURES="+strconv.Itoa(failures),
+		"INFLUXIN_HOOK_ERROR="+lastErr,
+	)
+	c.Stdout, c.Stderr = os.Stderr, os.Stderr
+	ilog.Printf("running hook for %s: %s", name, line)
+	if err := c.Run(); err != nil {
+		elog.Printf("hook %q for %s failed: %v", line, name, err)
+	}
+}
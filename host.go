@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// newHostInput returns the input of host metrics, sampled every interval
+// given as argument, 10 seconds by default.
+func newHostInput(arg string) (input, error) {
+	interval := 10 * time.Second
+	if arg != "" {
+		d, err := time.ParseDuration(arg)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid interval %q for input host", arg)
+		}
+		interval = d
+	}
+	return newHostSampler(interval)
+}
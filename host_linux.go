@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// hostInput samples the cpu, load, memory, disk and network usage of the
+// host from /proc every interval.
+type hostInput struct {
+	interval time.Duration
+	proc     string
+	lastCPU  []uint64 // jiffies of the previous sample
+}
+
+func newHostSampler(interval time.Duration) (input, error) {
+	return &hostInput{interval: interval, proc: "/proc"}, nil
+}
+
+func (h *hostInput) String() string {
+	return fmt.Sprintf("host metrics every %v", h.interval)
+}
+
+func (h *hostInput) run(ctx context.Context, rs *results) error {
+	ch := make(chan string)
+	defer close(ch)
+	go rs.collect(ch)
+	for {
+		for _, p := range h.sample() {
+			select {
+			case ch <- p.String():
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		if !sleep(ctx, h.interval) {
+			return nil
+		}
+	}
+}
+
+// sample returns the points of all the metrics that could be read.
+func (h *hostInput) sample() []*point {
+	var ps []*point
+	for _, f := range []func() ([]*point, error){h.cpu, h.load, h.mem, h.disk, h.net} {
+		p, err := f()
+		if err != nil {
+			dlog.Printf("host metrics: %v", err)
+			continue
+		}
+		ps = append(ps, p...)
+	}
+	return ps
+}
+
+// readLines returns the lines of a file under /proc.
+func (h *hostInput) readLines(name string) ([]string, error) {
+	f, err := os.Open(h.proc + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	return lines, sc.Err()
+}
+
+var cpuStates = []string{"user", "nice", "system", "idle", "iowait", "irq", "softirq", "steal"}
+
+// cpu returns the percentage of time spent in each state since the last
+// sample, for all the cpus together.
+func (h *hostInput) cpu() ([]*point, error) {
+	lines, err := h.readLines("stat")
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || !strings.HasPrefix(lines[0], "cpu ") {
+		return nil, fmt.Errorf("unexpected content of %s/stat", h.proc)
+	}
+	var cur []uint64
+	for _, v := range strings.Fields(lines[0])[1:] {
+		n, _ := strconv.ParseUint(v, 10, 64)
+		cur = append(cur, n)
+	}
+	last := h.lastCPU
+	h.lastCPU = cur
+	if len(last) == 0 || len(cur) < len(cpuStates) {
+		// rates need two samples
+		return nil, nil
+	}
+	var total uint64
+	for i := range cpuStates {
+		total += cur[i] - last[i]
+	}
+	if total == 0 {
+		return nil, nil
+	}
+	p := &point{measurement: "cpu", tags: []tag{{"cpu", "cpu-total"}}}
+	for i, s := range cpuStates {
+		p.setField("usage_"+s, formatFloat(float64(cur[i]-last[i])*100/float64(total)))
+	}
+	return []*point{p}, nil
+}
+
+func (h *hostInput) load() ([]*point, error) {
+	lines, err := h.readLines("loadavg")
+	if err != nil {
+		return nil, err
+	}
+	ws := strings.Fields(strings.Join(lines, " "))
+	if len(ws) < 3 {
+		return nil, fmt.Errorf("unexpected content of %s/loadavg", h.proc)
+	}
+	p := &point{measurement: "system"}
+	for i, name := range []string{"load1", "load5", "load15"} {
+		if _, err := strconv.ParseFloat(ws[i], 64); err == nil {
+			p.setField(name, ws[i])
+		}
+	}
+	return []*point{p}, nil
+}
+
+func (h *hostInput) mem() ([]*point, error) {
+	lines, err := h.readLines("meminfo")
+	if err != nil {
+		return nil, err
+	}
+	kb := make(map[string]uint64)
+	for _, l := range lines {
+		ws := strings.Fields(l)
+		if len(ws) >= 2 {
+			n, _ := strconv.ParseUint(ws[1], 10, 64)
+			kb[strings.TrimSuffix(ws[0], ":")] = n
+		}
+	}
+	total, avail := kb["MemTotal"], kb["MemAvailable"]
+	if total == 0 {
+		return nil, fmt.Errorf("unexpected content of %s/meminfo", h.proc)
+	}
+	p := &point{measurement: "mem"}
+	p.setField("total", strconv.FormatUint(total<<10, 10)+"i")
+	p.setField("available", strconv.FormatUint(avail<<10, 10)+"i")
+	p.setField("used", strconv.FormatUint((total-avail)<<10, 10)+"i")
+	p.setField("used_percent", formatFloat(float64(total-avail)*100/float64(total)))
+	p.setField("swap_total", strconv.FormatUint(kb["SwapTotal"]<<10, 10)+"i")
+	p.setField("swap_free", strconv.FormatUint(kb["SwapFree"]<<10, 10)+"i")
+	return []*point{p}, nil
+}
+
+// disk returns the usage of the filesystems mounted from block devices.
+func (h *hostInput) disk() ([]*point, error) {
+	lines, err := h.readLines("mounts")
+	if err != nil {
+		return nil, err
+	}
+	var ps []*point
+	seen := make(map[string]bool)
+	for _, l := range lines {
+		ws := strings.Fields(l)
+		if len(ws) < 3 || !strings.HasPrefix(ws[0], "/dev/") || seen[ws[0]] {
+			continue
+		}
+		seen[ws[0]] = true
+		// spaces and other characters are escaped as octal in mounts
+		path, err := strconv.Unquote(`"` + ws[1] + `"`)
+		if err != nil {
+			path = ws[1]
+		}
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(path, &st); err != nil {
+			continue
+		}
+		bs := uint64(st.Bsize)
+		total, free, avail := st.Blocks*bs, st.Bfree*bs, st.Bavail*bs
+		if total == 0 {
+			continue
+		}
+		p := &point{measurement: "disk"}
+		p.setTag("device", strings.TrimPrefix(ws[0], "/dev/"))
+		p.setTag("fstype", ws[2])
+		p.setTag("path", path)
+		p.setField("total", strconv.FormatUint(total, 10)+"i")
+		p.setField("free", strconv.FormatUint(avail, 10)+"i")
+		p.setField("used", strconv.FormatUint(total-free, 10)+"i")
+		if used := total - free; used+avail > 0 {
+			p.setField("used_percent", formatFloat(float64(used)*100/float64(used+avail)))
+		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
+
+var netCounters = []string{"bytes_recv", "packets_recv", "err_in", "drop_in", "", "", "", "", "bytes_sent", "packets_sent", "err_out", "drop_out"}
+
+// net returns the counters of the network interfaces, except loopback.
+func (h *hostInput) net() ([]*point, error) {
+	lines, err := h.readLines("net/dev")
+	if err != nil {
+		return nil, err
+	}
+	var ps []*point
+	for _, l := range lines {
+		i := strings.IndexByte(l, ':')
+		if i < 0 {
+			continue
+		}
+		iface := strings.TrimSpace(l[:i])
+		if iface == "lo" {
+			continue
+		}
+		ws := strings.Fields(l[i+1:])
+		p := &point{measurement: "net", tags: []tag{{"interface", iface}}}
+		for j, name := range netCounters {
+			if name != "" && j < len(ws) {
+				p.setField(name, ws[j]+"i")
+			}
+		}
+		if len(p.fields) > 0 {
+			ps = append(ps, p)
+		}
+	}
+	return ps, nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+func newHostSampler(interval time.Duration) (input, error) {
+	return nil, errors.New("host metrics are only available on Linux")
+}
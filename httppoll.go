@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pollFormats are the formats of the responses of polled URLs.
+var pollFormats = []string{"influx", "json", "prometheus"}
+
+// pollTarget is a URL fetched every interval.
+type pollTarget struct {
+	url         string
+	format      string
+	interval    time.Duration
+	timeout     time.Duration
+	measurement string // of json responses
+	selectors   jsonSelectors
+}
+
+// httpPollInput fetches the URLs listed in a file, one
+// "URL FORMAT INTERVAL [TIMEOUT [MEASUREMENT [SELECTOR...]]]" per line, and
+// converts the responses to measurements.
+type httpPollInput struct {
+	path    string
+	targets []pollTarget
+	client  *http.Client
+}
+
+func newHTTPPollInput(path string) (input, error) {
+	if path == "" {
+		return nil, errors.New("input http requires a file of URLs, like http:/etc/influxin/urls")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	in := httpPollInput{path: path, client: &http.Client{}}
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		ws := strings.Fields(sc.Text())
+		if len(ws) == 0 || ws[0][0] == '#' {
+			continue
+		}
+		t, err := parsePollTarget(ws)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		in.targets = append(in.targets, t)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+func parsePollTarget(ws []string) (pollTarget, error) {
+	var t pollTarget
+	if len(ws) < 3 {
+		return t, errors.New("expected URL FORMAT INTERVAL [TIMEOUT [MEASUREMENT [SELECTOR...]]]")
+	}
+	if u, err := url.Parse(ws[0]); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return t, fmt.Errorf("invalid URL %q", ws[0])
+	}
+	t.url, t.format, t.measurement = ws[0], ws[1], "http"
+	if !containsString(pollFormats, t.format) {
+		return t, fmt.Errorf("unknown format %q, use one of: %s", t.format, strings.Join(pollFormats, ", "))
+	}
+	var err error
+	if t.interval, err = time.ParseDuration(ws[2]); err != nil || t.interval <= 0 {
+		return t, fmt.Errorf("invalid interval %q", ws[2])
+	}
+	t.timeout = t.interval
+	if len(ws) > 3 {
+		if t.timeout, err = time.ParseDuration(ws[3]); err != nil || t.timeout <= 0 {
+			return t, fmt.Errorf("invalid timeout %q", ws[3])
+		}
+	}
+	if len(ws) > 4 {
+		t.measurement = ws[4]
+	}
+	if len(ws) > 5 {
+		if t.format != "json" {
+			return t, errors.New("selectors are only supported by the json format")
+		}
+		if t.selectors, err = parseJSONSelectors(ws[5:]); err != nil {
+			return t, err
+		}
+	}
+	return t, nil
+}
+
+func (in httpPollInput) String() string {
+	return fmt.Sprintf("%d URLs polled from %s", len(in.targets), in.path)
+}
+
+func (in httpPollInput) run(ctx context.Context, rs *results) error {
+	ch := make(chan string)
+	defer close(ch)
+	go rs.collect(ch)
+	var wg sync.WaitGroup
+	for _, t := range in.targets {
+		wg.Add(1)
+		go func(t pollTarget) {
+			defer wg.Done()
+			for {
+				lines, err := in.poll(ctx, t)
+				if err != nil && ctx.Err() == nil {
+					stats.Add("poll_errors", 1)
+					elog.Printf("polling %s: %v", redactURL(t.url), err)
+				}
+				for _, line := range lines {
+					select {
+					case ch <- line:
+					case <-ctx.Done():
+						return
+					}
+				}
+				if !sleep(ctx, t.interval) {
+					return
+				}
+			}
+		}(t)
+	}
+	wg.Wait()
+	return nil
+}
+
+// poll fetches the URL once and returns its measurements.
+func (in httpPollInput) poll(ctx context.Context, t pollTarget) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", t.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := in.client.Do(req)
+	if err != nil {
+		return nil, redactError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil, fmt.Errorf("expected status 2xx, got %s", resp.Status)
+	}
+	switch t.format {
+	case "json":
+		return parseJSONMetrics(resp.Body, t.measurement, t.selectors)
+	case "prometheus":
+		return parsePrometheus(resp.Body)
+	}
+	var lines []string
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		if line := strings.TrimSpace(sc.Text()); line != "" && line[0] != '#' {
+			lines = append(lines, line)
+		}
+	}
+	return lines, sc.Err()
+}
+
+// jsonSelectors pick the points, tags and fields of JSON documents.
+type jsonSelectors struct {
+	each   []string // path of the array or object whose elements are points
+	tags   []jsonSelector
+	fields []jsonSelector
+}
+
+// jsonSelector names the value at a path, relative to the point.
+type jsonSelector struct {
+	name string
+	path []string
+}
+
+// parseJSONSelectors parses the selectors "each=PATH", "tag:NAME=PATH" and
+// "field:NAME=PATH", where paths are keys and array indexes separated by
+// dots, like "data.items[0].cpu" or "$.data.items.0.cpu".
+func parseJSONSelectors(ws []string) (jsonSelectors, error) {
+	var s jsonSelectors
+	for _, w := range ws {
+		kv := strings.SplitN(w, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return s, fmt.Errorf("invalid selector %q: expected each=PATH, tag:NAME=PATH or field:NAME=PATH", w)
+		}
+		path := splitJSONPath(kv[1])
+		switch {
+		case kv[0] == "each":
+			s.each = path
+		case strings.HasPrefix(kv[0], "tag:") && len(kv[0]) > 4:
+			s.tags = append(s.tags, jsonSelector{kv[0][4:], path})
+		case strings.HasPrefix(kv[0], "field:") && len(kv[0]) > 6:
+			s.fields = append(s.fields, jsonSelector{kv[0][6:], path})
+		default:
+			return s, fmt.Errorf("invalid selector %q: expected each=PATH, tag:NAME=PATH or field:NAME=PATH", w)
+		}
+	}
+	return s, nil
+}
+
+func splitJSONPath(s string) []string {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "$"), ".")
+	s = strings.NewReplacer("[", ".", "]", "").Replace(s)
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ".")
+}
+
+// lookupJSON returns the value at path in v.
+func lookupJSON(v interface{}, path []string) (interface{}, bool) {
+	for _, k := range path {
+		switch e := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = e[k]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(k)
+			if err != nil || i < 0 || i >= len(e) {
+				return nil, false
+			}
+			v = e[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// parseJSONMetrics returns a point with the numbers, booleans and strings
+// of a JSON document as fields, named by their path joined by underscores.
+// With selectors, each element at the "each" path is a point, and only
+// the selected values are its tags and fields, or all of them if no field
+// is selected.
+func parseJSONMetrics(r io.Reader, measurement string, sel jsonSelectors) ([]string, error) {
+	var doc interface{}
+	d := json.NewDecoder(r)
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	roots := []interface{}{doc}
+	if sel.each != nil {
+		roots = nil
+		switch v, _ := lookupJSON(doc, sel.each); v := v.(type) {
+		case []interface{}:
+			roots = v
+		case map[string]interface{}:
+			keys := make([]string, 0, len(v))
+			for k := range v {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				roots = append(roots, v[k])
+			}
+		}
+	}
+	var lines []string
+	for _, root := range roots {
+		p := &point{measurement: measurement}
+		for _, s := range sel.tags {
+			if v, ok := lookupJSON(root, s.path); ok {
+				if val := jsonTagValue(v); val != "" {
+					p.setTag(s.name, val)
+				}
+			}
+		}
+		if len(sel.fields) == 0 {
+			flattenJSON(p, "", root)
+		}
+		for _, s := range sel.fields {
+			if v, ok := lookupJSON(root, s.path); ok {
+				flattenJSON(p, s.name, v)
+			}
+		}
+		if len(p.fields) == 0 {
+			continue
+		}
+		sort.Slice(p.fields, func(i, j int) bool { return p.fields[i].key < p.fields[j].key })
+		lines = append(lines, p.String())
+	}
+	return lines, nil
+}
+
+// jsonTagValue returns a scalar JSON value as a tag value.
+func jsonTagValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+func flattenJSON(p *point, prefix string, v interface{}) {
+	join := func(k string) string {
+		if prefix == "" {
+			return k
+		}
+		return prefix + "_" + k
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			flattenJSON(p, join(k), e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			flattenJSON(p, join(strconv.Itoa(i)), e)
+		}
+	case json.Number:
+		if prefix != "" {
+			p.setField(prefix, v.String())
+		}
+	case bool:
+		if prefix != "" {
+			p.setField(prefix, strconv.FormatBool(v))
+		}
+	case string:
+		if prefix != "" {
+			p.setField(prefix, quoteField(v))
+		}
+	}
+}
+
+// parsePrometheus converts the Prometheus text format: each sample becomes
+// a point named after the metric, with its labels as tags and a "value"
+// field. Timestamps are ignored.
+func parsePrometheus(r io.Reader) ([]string, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		p, err := parsePromSample(line)
+		if err != nil {
+			dlog.Printf("skipping prometheus sample %q: %v", line, err)
+			continue
+		}
+		if p != nil {
+			lines = append(lines, p.String())
+		}
+	}
+	return lines, sc.Err()
+}
+
+func parsePromSample(line string) (*point, error) {
+	p := &point{}
+	rest := line
+	if i := strings.IndexByte(line, '{'); i >= 0 {
+		j := strings.LastIndexByte(line, '}')
+		if j < i {
+			return nil, errors.New("unterminated labels")
+		}
+		p.measurement = line[:i]
+		labels, err := parsePromLabels(line[i+1 : j])
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range labels {
+			if t.value != "" {
+				p.setTag(t.key, t.value)
+			}
+		}
+		rest = line[j+1:]
+	} else {
+		i := strings.IndexAny(line, " \t")
+		if i < 0 {
+			return nil, errors.New("missing value")
+		}
+		p.measurement, rest = line[:i], line[i:]
+	}
+	ws := strings.Fields(rest)
+	if len(ws) == 0 {
+		return nil, errors.New("missing value")
+	}
+	f, err := strconv.ParseFloat(ws[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %q", ws[0])
+	}
+	if f != f || f > 1e308 || f < -1e308 {
+		// NaN and infinities cannot be written
+		return nil, nil
+	}
+	p.setField("value", formatFloat(f))
+	return p, nil
+}
+
+// parsePromLabels parses name="value" pairs separated by commas.
+func parsePromLabels(s string) ([]tag, error) {
+	var tags []tag
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimLeft(strings.TrimSpace(s), ",") {
+		i := strings.IndexByte(s, '=')
+		if i <= 0 || i+1 >= len(s) || s[i+1] != '"' {
+			return nil, fmt.Errorf("invalid label in %q", s)
+		}
+		name := strings.TrimSpace(s[:i])
+		s = s[i+2:]
+		var (
+			value strings.Builder
+			end   = -1
+		)
+		for j := 0; j < len(s); j++ {
+			if s[j] == '\\' && j+1 < len(s) {
+				j++
+				switch s[j] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[j])
+				}
+				continue
+			}
+			if s[j] == '"' {
+				end = j
+				break
+			}
+			value.WriteByte(s[j])
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated label value in %q", s)
+		}
+		tags = append(tags, tag{name, value.String()})
+		s = s[end+1:]
+	}
+	return tags, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// isV2Endpoint reports whether the endpoint is the write API of InfluxDB 2.
+func isV2Endpoint(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	return err == nil && strings.HasSuffix(u.Path, "api/v2/write")
+}
+
+// v2Endpoint turns a write endpoint into the one of the InfluxDB 2 API,
+// /api/v2/write with org and bucket parameters. The database of a v1
+// endpoint is the bucket, if none is given.
+func v2Endpoint(endpoint, org, bucket string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse influx endpoint URL: %v", err)
+	}
+	if u.User != nil {
+		return "", errors.New("the v2 API authenticates with -token, not a user; InfluxDB 1.8 accepts USER:PASSWORD as token")
+	}
+	if !strings.HasSuffix(u.Path, "api/v2/write") {
+		u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "write"), "/") + "/api/v2/write"
+	}
+	q := u.Query()
+	if bucket == "" {
+		bucket = q.Get("db")
+	}
+	if org != "" {
+		q.Set("org", org)
+	}
+	if bucket != "" {
+		q.Set("bucket", bucket)
+	}
+	q.Del("db")
+	if q.Get("org") == "" && q.Get("orgID") == "" {
+		return "", errors.New("the v2 API requires an -org")
+	}
+	if q.Get("bucket") == "" {
+		return "", errors.New("the v2 API requires a -bucket")
+	}
+	switch p := q.Get("precision"); p {
+	case "n":
+		q.Set("precision", "ns")
+	case "u":
+		q.Set("precision", "us")
+	case "m", "h":
+		return "", fmt.Errorf("precision %q is not supported by the v2 API", p)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// tokenTransport authenticates the requests to the InfluxDB endpoint with
+// an API token, read at each request so that it can be reloaded. Requests
+// to other services, like Kapacitor, are sent as they are.
+type tokenTransport struct {
+	base  http.RoundTripper
+	token *secret
+}
+
+func (t tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isForEndpoint(req) || req.Header.Get("Authorization") != "" {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Token "+t.token.load())
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// authRecorder is a server that records the Authorization header of the
+// requests it gets.
+type authRecorder struct {
+	*httptest.Server
+	mux  sync.Mutex
+	auth []string
+}
+
+func newAuthRecorder() *authRecorder {
+	r := &authRecorder{}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mux.Lock()
+		r.auth = append(r.auth, req.Header.Get("Authorization"))
+		r.mux.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return r
+}
+
+func (r *authRecorder) headers() []string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return append([]string(nil), r.auth...)
+}
+
+func TestTokenFollowsEndpoint(t *testing.T) {
+	a, b, kapacitor := newAuthRecorder(), newAuthRecorder(), newAuthRecorder()
+	defer a.Close()
+	defer b.Close()
+	defer kapacitor.Close()
+	client := &http.Client{Transport: tokenTransport{base: http.DefaultTransport, token: newSecret("secret")}}
+	ctx := context.Background()
+
+	s := newSubmitter(0, a.URL+"/api/v2/write?org=o&bucket=b", client, false)
+	if err := s.send(ctx, strings.NewReader("m v=1i\n"), ""); err != nil {
+		t.Fatal(err)
+	}
+	// a mapped destination follows the endpoint of s
+	dest := newSubmitter(0, "", client, false)
+	dest.follow = s
+	dest.db = "other"
+	s.setEndpoint(b.URL + "/api/v2/write?org=o&bucket=b")
+	for _, sub := range []*submitter{s, dest} {
+		if err := sub.send(ctx, strings.NewReader("m v=2i\n"), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	k := newSubmitter(0, kapacitor.URL+"/kapacitor/v1/write?db=m", client, false)
+	k.external = true
+	if err := k.send(ctx, strings.NewReader("m v=3i\n"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(a.headers(), ","); got != "Token secret" {
+		t.Errorf("first endpoint got Authorization %q", got)
+	}
+	if got := strings.Join(b.headers(), ","); got != "Token secret,Token secret" {
+		t.Errorf("switched endpoint got Authorization %q", got)
+	}
+	if got := strings.Join(kapacitor.headers(), ","); got != "" {
+		t.Errorf("Kapacitor got Authorization %q", got)
+	}
+}
+
+func TestOAuthFollowsEndpoint(t *testing.T) {
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"t1","expires_in":3600}`))
+	}))
+	defer tokens.Close()
+	a, b := newAuthRecorder(), newAuthRecorder()
+	defer a.Close()
+	defer b.Close()
+	client := &http.Client{Transport: newOAuthTransport(http.DefaultTransport, tokens.URL, "id", "secret", "")}
+	s := newSubmitter(0, a.URL+"/write?db=m", client, false)
+	for _, u := range []string{a.URL, b.URL} {
+		s.setEndpoint(u + "/write?db=m")
+		if err := s.send(context.Background(), strings.NewReader("m v=1i\n"), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, r := range []*authRecorder{a, b} {
+		if got := strings.Join(r.headers(), ","); got != "Bearer t1" {
+			t.Errorf("%s got Authorization %q", r.URL, got)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// input produces lines for the results until ctx is done or it has
+// nothing more to read.
+type input interface {
+	run(ctx context.Context, rs *results) error
+}
+
+// inputKinds are the inputs that can be added with -input KIND[:ARG].
+// Commands and synthetic measurements have their own flags.
+var inputKinds = map[string]func(arg string) (input, error){
+	"eventlog": newEventLogInput,
+	"host":     newHostInput,
+	"http":     newHTTPPollInput,
+	"nagios":   newNagiosInput,
+	"pdh":      newPdhInput,
+	"stdin":    newStdinInput,
+	"tail":     newTailInput,
+}
+
+// parseInput returns the input for a -input specification.
+func parseInput(spec string) (input, error) {
+	kind, arg := spec, ""
+	if i := strings.IndexByte(spec, ':'); i >= 0 {
+		kind, arg = spec[:i], spec[i+1:]
+	}
+	mk, ok := inputKinds[kind]
+	if !ok {
+		var kinds []string
+		for k := range inputKinds {
+			kinds = append(kinds, k)
+		}
+		sort.Strings(kinds)
+		return nil, fmt.Errorf("unknown input %q, use one of: %s", kind, strings.Join(kinds, ", "))
+	}
+	return mk(arg)
+}
+
+// runInputs runs the inputs until all of them are done.
+func runInputs(ctx context.Context, ins []input, rs *results) {
+	var wg sync.WaitGroup
+	for _, in := range ins {
+		wg.Add(1)
+		go func(in input) {
+			defer wg.Done()
+			if err := in.run(ctx, rs); err != nil {
+				elog.Printf("input %s: %v", describe(in), err)
+			}
+		}(in)
+	}
+	wg.Wait()
+}
+
+// cmdsInput runs commands given as arguments.
+type cmdsInput struct {
+	cmds  cmds
+	fatal bool
+}
+
+func (c cmdsInput) run(ctx context.Context, rs *results) error {
+	c.cmds.run(ctx, rs, c.fatal)
+	return nil
+}
+
+func (c cmdsInput) String() string {
+	var names []string
+	for i := range c.cmds {
+		names = append(names, strings.Join(append([]string{c.cmds[i].name}, c.cmds[i].args...), " "))
+	}
+	return strings.Join(names, "; ")
+}
+
+// cmdfileInput runs the commands of a command file, reloaded on SIGHUP.
+type cmdfileInput struct {
+	path    string
+	cmds    cmds
+	mkcmd   func() cmd
+	tdata   *templateData
+	scripts *scriptLibrary
+	fatal   bool
+}
+
+func (c cmdfileInput) run(ctx context.Context, rs *results) error {
+	return runCmdfile(ctx, c.path, c.cmds, c.mkcmd, c.tdata, c.scripts, rs, c.fatal)
+}
+
+func (c cmdfileInput) String() string {
+	return "commands from " + c.path
+}
+
+// generatorInput produces synthetic measurements.
+type generatorInput struct {
+	gen  *generator
+	rate int
+}
+
+func (g generatorInput) run(ctx context.Context, rs *results) error {
+	ch := make(chan string)
+	go g.gen.run(ctx, g.rate, ch)
+	rs.collect(ch)
+	return nil
+}
+
+func (g generatorInput) String() string {
+	return fmt.Sprintf("%d synthetic measurements per second", g.rate)
+}
+
+// readerInput reads lines until the end of r.
+type readerInput struct {
+	name string
+	r    io.Reader
+}
+
+func newStdinInput(arg string) (input, error) {
+	if arg != "" {
+		return nil, fmt.Errorf("input stdin takes no argument")
+	}
+	return readerInput{name: "standard input", r: os.Stdin}, nil
+}
+
+// run returns at the end of r or as soon as ctx is done. In the latter
+// case the reading goroutine is left blocked until r is closed, as reads
+// cannot be interrupted.
+func (in readerInput) run(ctx context.Context, rs *results) error {
+	ch := make(chan string)
+	collected := make(chan struct{})
+	go func() {
+		defer close(collected)
+		rs.collect(ch)
+	}()
+	defer func() {
+		close(ch)
+		<-collected
+	}()
+	lines := make(chan string)
+	done := make(chan error, 1)
+	go func() {
+		sc := bufio.NewScanner(in.r)
+		for sc.Scan() {
+			select {
+			case lines <- sc.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+		done <- sc.Err()
+	}()
+	for {
+		select {
+		case line := <-lines:
+			select {
+			case ch <- line:
+			case <-ctx.Done():
+				return nil
+			}
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (in readerInput) String() string {
+	return in.name
+}
+
+// tailInput follows a file like "tail -F": it reads the lines appended to
+// it, starting again from the beginning when the file is truncated or
+// replaced.
+type tailInput struct {
+	path string
+	poll time.Duration
+}
+
+func newTailInput(path string) (input, error) {
+	if path == "" {
+		return nil, fmt.Errorf("input tail requires a file, like tail:/var/log/metrics.log")
+	}
+	return tailInput{path: path, poll: time.Second}, nil
+}
+
+func (t tailInput) String() string {
+	return "tail of " + t.path
+}
+
+func (t tailInput) run(ctx context.Context, rs *results) error {
+	ch := make(chan string)
+	defer close(ch)
+	go rs.collect(ch)
+	var (
+		f       *os.File
+		r       *bufio.Reader
+		partial string
+		offset  int64
+	)
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	for first := true; ; first = false {
+		if f == nil {
+			var err error
+			if f, err = os.Open(t.path); err == nil {
+				r, partial, offset = bufio.NewReader(f), "", 0
+				if first {
+					// only follow what is appended from now on
+					if offset, err = f.Seek(0, io.SeekEnd); err != nil {
+						return fmt.Errorf("cannot seek: %v", err)
+					}
+				}
+			} else if !os.IsNotExist(err) {
+				return err
+			}
+		}
+		for f != nil {
+			line, err := r.ReadString('\n')
+			offset += int64(len(line))
+			if err != nil {
+				partial += line
+				break
+			}
+			select {
+			case ch <- strings.TrimRight(partial+line, "\r\n"):
+			case <-ctx.Done():
+				return nil
+			}
+			partial = ""
+		}
+		if !sleep(ctx, t.poll) {
+			return nil
+		}
+		if f == nil {
+			continue
+		}
+		// reopen if the file was replaced or truncated
+		fi, err := os.Stat(t.path)
+		cur, cerr := f.Stat()
+		if err != nil || cerr != nil || !os.SameFile(fi, cur) || fi.Size() < offset {
+			f.Close()
+			f = nil
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lineCollector keeps the lines it receives.
+type lineCollector struct {
+	mux   sync.Mutex
+	lines []string
+}
+
+func (c *lineCollector) collect(ctx context.Context, ch <-chan string) {
+	for {
+		select {
+		case line := <-ch:
+			c.mux.Lock()
+			c.lines = append(c.lines, line)
+			c.mux.Unlock()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func TestReaderInputLines(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &lineCollector{}
+	rs, err := newResults(ctx, []collector{c}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := readerInput{name: "test", r: strings.NewReader("a v=1i\nb v=2i\n")}
+	if err := in.run(ctx, rs); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	rs.wait()
+	if got := strings.Join(c.lines, ";"); got != "a v=1i;b v=2i" {
+		t.Errorf("got lines %q", got)
+	}
+}
+
+func TestReaderInputIdleCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	rs, err := newResults(context.Background(), []collector{&lineCollector{}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, w := io.Pipe()
+	defer w.Close()
+	done := make(chan error, 1)
+	go func() {
+		done <- readerInput{name: "idle pipe", r: r}.run(ctx, rs)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("input did not return after cancel with no data on the reader")
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+// maxDatagram is the size of the UDP packets sent to Kapacitor, small
+// enough to avoid fragmentation on most networks.
+const maxDatagram = 1400
+
+// filterCollector passes the measurements matching all conds to next. It
+// is not a router, so next gets the measurements of every route.
+type filterCollector struct {
+	conds []*condition
+	next  collector
+}
+
+func (f filterCollector) String() string {
+	if len(f.conds) == 0 {
+		return describe(f.next)
+	}
+	return describe(f.next) + ", filtered"
+}
+
+func (f filterCollector) collect(ctx context.Context, ch <-chan string) {
+	next := make(chan string)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.next.collect(ctx, next)
+	}()
+	for {
+		select {
+		case line := <-ch:
+			p, err := parsePoint(line)
+			if err != nil || !matchAll(f.conds, p) {
+				continue
+			}
+			select {
+			case next <- line:
+			case <-done:
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// matchAll reports whether p matches all conds.
+func matchAll(conds []*condition, p *point) bool {
+	for _, c := range conds {
+		if !c.match(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// udpCollector sends measurements in UDP packets, like the UDP service of
+// Kapacitor and InfluxDB 1.x expects them.
+type udpCollector struct {
+	addr string
+	conn net.Conn
+}
+
+func newUDPCollector(addr string) (*udpCollector, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &udpCollector{addr: addr, conn: conn}, nil
+}
+
+func (u *udpCollector) String() string {
+	return "UDP " + u.addr
+}
+
+func (u *udpCollector) collect(ctx context.Context, ch <-chan string) {
+	var buf bytes.Buffer
+	tick := time.NewTicker(clk.wait(time.Second))
+	defer tick.Stop()
+	for {
+		select {
+		case line := <-ch:
+			if buf.Len() > 0 && buf.Len()+len(line)+1 > maxDatagram {
+				u.send(&buf)
+			}
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		case <-tick.C:
+			u.send(&buf)
+		case <-ctx.Done():
+			u.send(&buf)
+			u.conn.Close()
+			return
+		}
+	}
+}
+
+func (u *udpCollector) send(buf *bytes.Buffer) {
+	if buf.Len() == 0 {
+		return
+	}
+	if _, err := u.conn.Write(buf.Bytes()); err != nil {
+		stats.Add("udp_errors", 1)
+		elog.Printf("cannot send to %s: %v", u.addr, err)
+	}
+	buf.Reset()
+}
+
+// kapacitorSink returns the collector forwarding to a Kapacitor write URL,
+// either udp://HOST:PORT or the HTTP write API, like
+// http://HOST:9092/kapacitor/v1/write?db=DB&rp=RP. For HTTP it returns the
+// collector made by newBatch for the URL.
+func kapacitorSink(rawurl string, newBatch func(endpoint string) collector) (collector, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "udp":
+		return newUDPCollector(u.Host)
+	case "http", "https":
+		if u.Query().Get("db") == "" {
+			return nil, fmt.Errorf("missing db parameter in %s", redactURL(rawurl))
+		}
+		return newBatch(rawurl), nil
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q: use udp, http or https", u.Scheme)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"expvar"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the cumulative
+// histogram of the delivery latency.
+var latencyBuckets = []float64{1, 5, 10, 30, 60, 90, 120, 300, 600}
+
+// latencyTracker accounts the time from reading the oldest line of each
+// batch to its successful submission, and counts the batches that took
+// longer than the SLO, if set.
+type latencyTracker struct {
+	slo time.Duration
+	m   *expvar.Map
+}
+
+func newLatencyTracker(slo time.Duration) *latencyTracker {
+	l := &latencyTracker{slo: slo, m: new(expvar.Map).Init()}
+	for _, le := range latencyBuckets {
+		l.m.Add("le_"+formatFloat(le), 0)
+	}
+	l.m.Add("le_inf", 0)
+	l.m.Add("count", 0)
+	l.m.AddFloat("sum_seconds", 0)
+	if slo > 0 {
+		l.m.Set("slo_seconds", expvarFloat(slo.Seconds()))
+		l.m.Add("slo_violations", 0)
+	}
+	stats.Set("latency", l.m)
+	return l
+}
+
+func (l *latencyTracker) observe(d time.Duration) {
+	secs := d.Seconds()
+	for _, le := range latencyBuckets {
+		if secs <= le {
+			l.m.Add("le_"+formatFloat(le), 1)
+		}
+	}
+	l.m.Add("le_inf", 1)
+	l.m.Add("count", 1)
+	l.m.AddFloat("sum_seconds", secs)
+	if l.slo > 0 && d > l.slo {
+		l.m.Add("slo_violations", 1)
+		dlog.Printf("batch delivered %v after its first line was read, over the SLO of %v", d.Round(time.Millisecond), l.slo)
+	}
+}
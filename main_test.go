@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// set up by main
+	ilog = log.New(ioutil.Discard, "", 0)
+	elog = log.New(ioutil.Discard, "", 0)
+	flog = log.New(ioutil.Discard, "", 0)
+	dlog = log.New(ioutil.Discard, "", 0)
+	dumplog = dlog
+	os.Exit(m.Run())
+}
+
+func TestJoinLinesIdle(t *testing.T) {
+	r, w := io.Pipe()
+	sent := make(chan string, 2)
+	done := make(chan struct{})
+	go func() {
+		joinLines(bufio.NewScanner(r), regexp.MustCompile(`^\s`), " ", 20*time.Millisecond, func(l string) { sent <- l })
+		close(done)
+	}()
+	fmt.Fprint(w, "error: failed\n  at main\n")
+	select {
+	case l := <-sent:
+		if l != "error: failed at main" {
+			t.Errorf("joined %q", l)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("last joined line not sent while the input is idle")
+	}
+	fmt.Fprint(w, "next\n")
+	w.Close()
+	<-done
+	if l := <-sent; l != "next" {
+		t.Errorf("sent %q at the end of input, want next", l)
+	}
+}
+
+// batchLines returns n lines like the ones of a typical collector.
+func batchLines(n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("cpu,host=web%02d,cpu=cpu%d usage_user=%d.25,usage_system=1.5,usage_idle=90 %d",
+			i%20, i%8, i%100, 1600000000000000000+int64(i))
+	}
+	return lines
+}
+
+// BenchmarkBatchEncode measures the serialization of a full batch, as done
+// at every flush.
+func BenchmarkBatchEncode(b *testing.B) {
+	lines := batchLines(5000)
+	bc := newBatchCollector(len(lines), time.Minute, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bc.batchi = copy(bc.batch, lines)
+		if _, err := bc.encode(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkBatchEncodeFprintln is the serialization used before encode, as
+// a reference: every line is formatted with fmt.Fprintln into a buffer
+// that grows as needed.
+func BenchmarkBatchEncodeFprintln(b *testing.B) {
+	lines := batchLines(5000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var buf bytes.Buffer
+		for _, l := range lines {
+			fmt.Fprintln(&buf, l)
+		}
+	}
+}
+
+func TestBatchEncode(t *testing.T) {
+	lines := batchLines(10)
+	bc := newBatchCollector(len(lines), time.Minute, nil)
+	bc.batchi = copy(bc.batch, lines)
+	b, err := bc.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	for _, l := range lines {
+		fmt.Fprintln(&want, l)
+	}
+	if !bytes.Equal(b, want.Bytes()) {
+		t.Errorf("encoded batch differs:\n%s\nwant:\n%s", b, want.Bytes())
+	}
+	if bc.batchi != 0 {
+		t.Errorf("batch not emptied, %d lines left", bc.batchi)
+	}
+}
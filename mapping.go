@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// mappingEntry sends the measurements matching a glob to a database, or
+// bucket, and optionally a retention policy.
+type mappingEntry struct {
+	glob   string
+	db, rp string
+}
+
+// readMapping reads a mapping file, with one "GLOB DATABASE [RP]" per line.
+// Empty lines and lines starting with # are ignored.
+func readMapping(file string) ([]mappingEntry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []mappingEntry
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		ws := strings.Fields(line)
+		if len(ws) < 2 || len(ws) > 3 {
+			return nil, fmt.Errorf("%s:%d: expected GLOB DATABASE [RP]", file, n)
+		}
+		if _, err := path.Match(ws[0], ""); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid glob %q: %v", file, n, ws[0], err)
+		}
+		e := mappingEntry{glob: ws[0], db: ws[1]}
+		if len(ws) == 3 {
+			e.rp = ws[2]
+		}
+		entries = append(entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// mapping holds the entries of a mapping file, reloaded when it changes.
+type mapping struct {
+	file    string
+	entries atomic.Value // []mappingEntry
+}
+
+func newMapping(file string) (*mapping, error) {
+	entries, err := readMapping(file)
+	if err != nil {
+		return nil, err
+	}
+	m := &mapping{file: file}
+	m.entries.Store(entries)
+	return m, nil
+}
+
+// lookup returns the entry of the first glob matching measurement.
+func (m *mapping) lookup(measurement string) (mappingEntry, bool) {
+	for _, e := range m.entries.Load().([]mappingEntry) {
+		if ok, _ := path.Match(e.glob, measurement); ok {
+			return e, true
+		}
+	}
+	return mappingEntry{}, false
+}
+
+// watch reloads the file when its modification time changes. An invalid
+// file is logged and the previous mapping is kept.
+func (m *mapping) watch(ctx context.Context, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	var modTime time.Time
+	if fi, err := os.Stat(m.file); err == nil {
+		modTime = fi.ModTime()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		fi, err := os.Stat(m.file)
+		if err != nil || fi.ModTime().Equal(modTime) {
+			continue
+		}
+		modTime = fi.ModTime()
+		entries, err := readMapping(m.file)
+		if err != nil {
+			elog.Printf("cannot reload mapping, keeping the previous one: %v", err)
+			continue
+		}
+		m.entries.Store(entries)
+		ilog.Printf("reloaded %d mappings from %s", len(entries), m.file)
+	}
+}
+
+// mappedCollector passes each measurement to the collector of the database
+// and retention policy it is mapped to, made by newDest when first needed.
+// Measurements not mapped go to def.
+type mappedCollector struct {
+	mapping *mapping
+	def     collector
+	newDest func(db, rp string) collector
+
+	mux   sync.Mutex
+	dests map[mappingEntry]collector // glob left empty
+}
+
+func newMappedCollector(m *mapping, def collector, newDest func(db, rp string) collector) *mappedCollector {
+	return &mappedCollector{
+		mapping: m,
+		def:     def,
+		newDest: newDest,
+		dests:   make(map[mappingEntry]collector),
+	}
+}
+
+func (m *mappedCollector) String() string {
+	return describe(m.def) + ", mapped by " + m.mapping.file
+}
+
+func (m *mappedCollector) route() string {
+	if r, ok := m.def.(router); ok {
+		return r.route()
+	}
+	return ""
+}
+
+func (m *mappedCollector) requestFlush() {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if f, ok := m.def.(flusher); ok {
+		f.requestFlush()
+	}
+	for _, c := range m.dests {
+		if f, ok := c.(flusher); ok {
+			f.requestFlush()
+		}
+	}
+}
+
+func (m *mappedCollector) collect(ctx context.Context, ch <-chan string) {
+	var wg sync.WaitGroup
+	start := func(c collector) chan string {
+		ch := make(chan string)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.collect(ctx, ch)
+		}()
+		return ch
+	}
+	def := start(m.def)
+	chans := make(map[mappingEntry]chan string)
+	for {
+		select {
+		case line := <-ch:
+			out := def
+			if p, err := parsePoint(line); err == nil {
+				if e, ok := m.mapping.lookup(p.measurement); ok {
+					e.glob = ""
+					if out, ok = chans[e]; !ok {
+						c := m.newDest(e.db, e.rp)
+						m.mux.Lock()
+						m.dests[e] = c
+						m.mux.Unlock()
+						out = start(c)
+						chans[e] = out
+						ilog.Printf("writing measurements to new mapped destination: %s", describe(c))
+					}
+				}
+			}
+			select {
+			case out <- line:
+			case <-ctx.Done():
+			}
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import "strconv"
+
+// mergePoints merges the lines sharing measurement, tags and timestamp into
+// a single line with the union of their fields. When a field repeats, the
+// last value wins. Lines that cannot be parsed are kept as they are.
+func mergePoints(lines []string) []string {
+	merged := make([]string, 0, len(lines))
+	points := make(map[string]*point)
+	index := make(map[string]int) // position in merged
+	for _, line := range lines {
+		p, err := parsePoint(line)
+		if err != nil {
+			merged = append(merged, line)
+			continue
+		}
+		key := seriesKey(p)
+		if p.hasTime {
+			key += " " + strconv.FormatInt(p.time, 10)
+		}
+		prev, ok := points[key]
+		if !ok {
+			points[key] = p
+			index[key] = len(merged)
+			merged = append(merged, line)
+			continue
+		}
+		for _, f := range p.fields {
+			prev.setField(f.key, f.value)
+		}
+		merged[index[key]] = prev.String()
+	}
+	return merged
+}
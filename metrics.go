@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/tls"
+	"expvar"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// stats holds the counters about influxin's own operation. They are
+// published, with the rest of expvar, on /debug/vars of the admin listener.
+var stats = expvar.NewMap("influxin")
+
+var (
+	endpointsMux   sync.Mutex
+	endpointsStats = new(expvar.Map).Init()
+)
+
+func init() {
+	stats.Set("endpoints", endpointsStats)
+}
+
+// endpointStats returns the transport metrics of an endpoint host.
+func endpointStats(host string) *expvar.Map {
+	endpointsMux.Lock()
+	defer endpointsMux.Unlock()
+	if v := endpointsStats.Get(host); v != nil {
+		return v.(*expvar.Map)
+	}
+	m := new(expvar.Map).Init()
+	endpointsStats.Set(host, m)
+	return m
+}
+
+// addTiming accounts the duration of a request phase since start.
+func addTiming(m *expvar.Map, phase string, start time.Time) {
+	if start.IsZero() {
+		return
+	}
+	m.Add(phase+"_count", 1)
+	m.AddFloat(phase+"_ms_total", float64(time.Since(start))/float64(time.Millisecond))
+}
+
+// transportTrace records connection reuse and the timings of DNS
+// resolution, connection, TLS handshake and time to first byte in m.
+func transportTrace(m *expvar.Map) *httptrace.ClientTrace {
+	var dnsStart, connectStart, tlsStart, reqStart time.Time
+	return &httptrace.ClientTrace{
+		GetConn: func(string) {
+			reqStart = time.Now()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				m.Add("conn_reused", 1)
+			} else {
+				m.Add("conn_new", 1)
+			}
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			addTiming(m, "dns", dnsStart)
+		},
+		ConnectStart: func(string, string) {
+			connectStart = time.Now()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				addTiming(m, "connect", connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				addTiming(m, "tls", tlsStart)
+			}
+		},
+		GotFirstResponseByte: func() {
+			addTiming(m, "ttfb", reqStart)
+		},
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// nagiosCheck is a Nagios plugin run periodically.
+type nagiosCheck struct {
+	name     string
+	interval time.Duration
+	line     string
+}
+
+// nagiosInput runs the Nagios plugins listed in a file, one
+// "NAME INTERVAL COMMAND ARGS..." per line, and converts their state and
+// performance data to measurements named after the check.
+type nagiosInput struct {
+	path   string
+	checks []nagiosCheck
+}
+
+func newNagiosInput(path string) (input, error) {
+	if path == "" {
+		return nil, errors.New("input nagios requires a file of checks, like nagios:/etc/influxin/checks")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	in := nagiosInput{path: path}
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		ws := strings.Fields(line)
+		if len(ws) < 3 {
+			return nil, fmt.Errorf("%s:%d: expected NAME INTERVAL COMMAND", path, n)
+		}
+		d, err := time.ParseDuration(ws[1])
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%s:%d: invalid interval %q", path, n, ws[1])
+		}
+		// the command line is passed to the shell as written
+		cmdline := strings.TrimSpace(line[len(ws[0]):])
+		cmdline = strings.TrimSpace(cmdline[len(ws[1]):])
+		in.checks = append(in.checks, nagiosCheck{name: ws[0], interval: d, line: cmdline})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+func (in nagiosInput) String() string {
+	return fmt.Sprintf("%d Nagios checks from %s", len(in.checks), in.path)
+}
+
+func (in nagiosInput) run(ctx context.Context, rs *results) error {
+	ch := make(chan string)
+	defer close(ch)
+	go rs.collect(ch)
+	var wg sync.WaitGroup
+	for _, c := range in.checks {
+		wg.Add(1)
+		go func(c nagiosCheck) {
+			defer wg.Done()
+			for {
+				if line, err := c.run(ctx); err != nil {
+					if ctx.Err() != nil {
+						return
+					}
+					elog.Printf("nagios check %s: %v", c.name, err)
+				} else {
+					select {
+					case ch <- line:
+					case <-ctx.Done():
+					}
+				}
+				if !sleep(ctx, c.interval) {
+					return
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+	return nil
+}
+
+// run runs the plugin once, within its interval, and returns its
+// measurement.
+func (c nagiosCheck) run(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.interval)
+	defer cancel()
+	shell := "sh"
+	if runtime.GOOS == "windows" {
+		shell = "cmd"
+	}
+	cmd, err := shellCommand(ctx, shell, c.line)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	state := 0
+	if err := cmd.Run(); err != nil {
+		var exit *exec.ExitError
+		if !errors.As(err, &exit) || ctx.Err() != nil {
+			return "", err
+		}
+		state = exit.ExitCode()
+		if state < 0 || state > 3 {
+			state = 3 // UNKNOWN
+		}
+	}
+	p := parseNagios(c.name, out.String())
+	p.setField("state", strconv.Itoa(state)+"i")
+	return p.String(), nil
+}
+
+// parseNagios converts the output of a plugin to a point: the status text
+// is the "message" field and each performance data label becomes a field
+// with its value, without unit, and fields for its warning, critical, min
+// and max thresholds, when they are numbers.
+func parseNagios(name, out string) *point {
+	p := &point{measurement: name}
+	var msg string
+	for i, line := range strings.Split(strings.TrimRight(out, "\n"), "\n") {
+		text, perf := line, ""
+		if j := strings.IndexByte(line, '|'); j >= 0 {
+			text, perf = line[:j], line[j+1:]
+		}
+		if i == 0 {
+			msg = strings.TrimSpace(text)
+		}
+		for _, pd := range splitPerfdata(perf) {
+			addPerfdata(p, pd)
+		}
+	}
+	if msg != "" {
+		p.setField("message", quoteField(msg))
+	}
+	return p
+}
+
+// splitPerfdata splits performance data on spaces, except within a quoted
+// label.
+func splitPerfdata(s string) []string {
+	var (
+		pds    []string
+		quoted bool
+		start  = -1
+	)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\'':
+			quoted = !quoted
+			if start < 0 {
+				start = i
+			}
+		case s[i] == ' ' && !quoted:
+			if start >= 0 {
+				pds = append(pds, s[start:i])
+				start = -1
+			}
+		case start < 0:
+			start = i
+		}
+	}
+	if start >= 0 {
+		pds = append(pds, s[start:])
+	}
+	return pds
+}
+
+// addPerfdata adds the fields of one 'label'=value[UOM];[warn];[crit];[min];[max].
+func addPerfdata(p *point, pd string) {
+	i := strings.LastIndexByte(pd, '=')
+	if i <= 0 {
+		return
+	}
+	label := strings.Trim(pd[:i], "'")
+	parts := strings.Split(pd[i+1:], ";")
+	value := strings.TrimRight(parts[0], "%abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	if _, err := strconv.ParseFloat(value, 64); err != nil {
+		return
+	}
+	p.setField(label, value)
+	for j, suffix := range []string{"_warn", "_crit", "_min", "_max"} {
+		if j+1 >= len(parts) {
+			break
+		}
+		// ranges like 10:20 are not numbers and are left out
+		if _, err := strconv.ParseFloat(parts[j+1], 64); err == nil {
+			p.setField(label+suffix, parts[j+1])
+		}
+	}
+}
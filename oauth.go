@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// oauthTransport authenticates requests with a bearer token obtained with
+// the OAuth2 client credentials flow. The token is renewed shortly before
+// it expires, or when the server rejects it. Only the requests to the
+// InfluxDB endpoint are authenticated.
+type oauthTransport struct {
+	base         http.RoundTripper
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scopes       string
+
+	mux     sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newOAuthTransport(base http.RoundTripper, tokenURL, clientID, clientSecret, scopes string) *oauthTransport {
+	return &oauthTransport{
+		base:         base,
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scopes:       strings.Replace(scopes, ",", " ", -1),
+	}
+}
+
+func (t *oauthTransport) fetchToken() (string, time.Duration, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if t.scopes != "" {
+		form.Set("scope", t.scopes)
+	}
+	req, err := http.NewRequest("POST", t.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(t.clientID), url.QueryEscape(t.clientSecret))
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, resp.Body)
+		return "", 0, fmt.Errorf("expected status 200, got %s", resp.Status)
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", 0, fmt.Errorf("cannot decode token response: %v", err)
+	}
+	if tok.AccessToken == "" {
+		return "", 0, fmt.Errorf("no access token in response")
+	}
+	return tok.AccessToken, time.Duration(tok.ExpiresIn) * time.Second, nil
+}
+
+func (t *oauthTransport) getToken() (string, error) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if t.token != "" && time.Now().Before(t.expires) {
+		return t.token, nil
+	}
+	token, ttl, err := t.fetchToken()
+	if err != nil {
+		return "", fmt.Errorf("cannot get OAuth2 token: %v", err)
+	}
+	// renew a bit earlier than needed to not send expired tokens
+	if ttl > time.Minute {
+		ttl -= 30 * time.Second
+	}
+	t.token, t.expires = token, time.Now().Add(ttl)
+	return t.token, nil
+}
+
+// invalidate forgets token, if it is still the current one.
+func (t *oauthTransport) invalidate(token string) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if t.token == token {
+		t.token = ""
+	}
+}
+
+func (t *oauthTransport) send(req *http.Request, token string) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.base.RoundTrip(req)
+}
+
+func (t *oauthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isForEndpoint(req) {
+		return t.base.RoundTrip(req)
+	}
+	token, err := t.getToken()
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	resp, err := t.send(req, token)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || (req.Body != nil && req.GetBody == nil) {
+		return resp, err
+	}
+	// the token was revoked before it expired: retry once with a new one
+	t.invalidate(token)
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	if token, err = t.getToken(); err != nil {
+		if retry.Body != nil {
+			retry.Body.Close()
+		}
+		return resp, nil
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return t.send(retry, token)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// parseAlarm tracks the ratio of lines of a command that are not valid
+// line protocol. At the end of each window, if the ratio is over the
+// threshold, an error is logged and an alert measurement is produced.
+type parseAlarm struct {
+	threshold float64
+	window    time.Duration
+	start     time.Time
+	lines     int
+	errors    int
+	raised    bool
+}
+
+// parseAlarmMinLines avoids alarms on windows with too few lines.
+const parseAlarmMinLines = 10
+
+func newParseAlarm(threshold float64, window time.Duration) *parseAlarm {
+	return &parseAlarm{threshold: threshold, window: window, start: time.Now()}
+}
+
+// check counts a line of the command called name. It returns the alert
+// measurement to send, if any.
+func (a *parseAlarm) check(name, line string) (string, bool) {
+	a.lines++
+	if _, err := parsePoint(line); err != nil {
+		a.errors++
+	}
+	now := time.Now()
+	if now.Sub(a.start) < a.window {
+		return "", false
+	}
+	lines, errors := a.lines, a.errors
+	a.start, a.lines, a.errors = now, 0, 0
+	ratio := float64(errors) / float64(lines)
+	if lines < parseAlarmMinLines || ratio <= a.threshold {
+		if a.raised {
+			ilog.Printf("command %s is producing valid lines again", name)
+			a.raised = false
+		}
+		return "", false
+	}
+	a.raised = true
+	stats.Add("parse_alarms", 1)
+	elog.Printf("ALERT: %d of %d lines from command %s are not valid line protocol in the last %v", errors, lines, name, a.window)
+	p := &point{measurement: "influxin_parse_errors", tags: []tag{{"command", name}}}
+	p.setField("lines", strconv.Itoa(lines)+"i")
+	p.setField("errors", strconv.Itoa(errors)+"i")
+	p.setField("ratio", strconv.FormatFloat(ratio, 'f', -1, 64))
+	return p.String(), true
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// pdhCounter is a Windows performance counter, like
+// \Processor(_Total)\% Processor Time, sampled every interval.
+type pdhCounter struct {
+	path     string
+	interval time.Duration
+	object   string // measurement
+	instance string // tag, if any
+	counter  string // field
+}
+
+// parseCounterPath splits a counter path in its object, instance and
+// counter names. Wildcards are not supported.
+func parseCounterPath(path string) (pdhCounter, error) {
+	c := pdhCounter{path: path}
+	if !strings.HasPrefix(path, `\`) || strings.ContainsAny(path, "*?") {
+		return c, fmt.Errorf("invalid counter %q: expected \\Object(Instance)\\Counter without wildcards", path)
+	}
+	i := strings.LastIndexByte(path, '\\')
+	if i == 0 {
+		return c, fmt.Errorf("invalid counter %q: expected \\Object(Instance)\\Counter", path)
+	}
+	c.object, c.counter = path[1:i], path[i+1:]
+	if j := strings.IndexByte(c.object, '('); j > 0 && strings.HasSuffix(c.object, ")") {
+		c.object, c.instance = c.object[:j], c.object[j+1:len(c.object)-1]
+	}
+	return c, nil
+}
+
+// readCounters reads a file of "INTERVAL COUNTER" lines.
+func readCounters(file string) ([]pdhCounter, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var cs []pdhCounter
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		i := strings.IndexAny(line, " \t")
+		if i < 0 {
+			return nil, fmt.Errorf("%s:%d: expected INTERVAL COUNTER", file, n)
+		}
+		d, err := time.ParseDuration(line[:i])
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%s:%d: invalid interval %q", file, n, line[:i])
+		}
+		c, err := parseCounterPath(strings.TrimSpace(line[i:]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", file, n, err)
+		}
+		c.interval = d
+		cs = append(cs, c)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// point returns the measurement of a sampled value.
+func (c pdhCounter) point(value float64) *point {
+	p := &point{measurement: c.object}
+	if c.instance != "" {
+		p.setTag("instance", c.instance)
+	}
+	p.setField(c.counter, formatFloat(value))
+	return p
+}
+
+func newPdhInput(file string) (input, error) {
+	if file == "" {
+		return nil, errors.New("input pdh requires a file of counters, like pdh:C:\\influxin\\counters.txt")
+	}
+	cs, err := readCounters(file)
+	if err != nil {
+		return nil, err
+	}
+	return newPdhSampler(file, cs)
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+func newPdhSampler(file string, cs []pdhCounter) (input, error) {
+	return nil, errors.New("performance counters are only available on Windows")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	pdh                         = syscall.NewLazyDLL("pdh.dll")
+	pdhOpenQuery                = pdh.NewProc("PdhOpenQueryW")
+	pdhAddEnglishCounter        = pdh.NewProc("PdhAddEnglishCounterW")
+	pdhCollectQueryData         = pdh.NewProc("PdhCollectQueryData")
+	pdhGetFormattedCounterValue = pdh.NewProc("PdhGetFormattedCounterValue")
+	pdhCloseQuery               = pdh.NewProc("PdhCloseQuery")
+)
+
+const pdhFmtDouble = 0x00000200
+
+// pdhFmtCounterValue is PDH_FMT_COUNTERVALUE with a double value.
+type pdhFmtCounterValue struct {
+	cStatus uint32
+	_       uint32 // the union is 8 bytes aligned
+	value   float64
+}
+
+// pdhQuery is an open query with a single counter.
+type pdhQuery struct {
+	query, counter uintptr
+}
+
+func pdhError(fn string, r uintptr) error {
+	return fmt.Errorf("%s failed with status 0x%08x", fn, uint32(r))
+}
+
+func openPdhQuery(path string) (*pdhQuery, error) {
+	q := &pdhQuery{}
+	if r, _, _ := pdhOpenQuery.Call(0, 0, uintptr(unsafe.Pointer(&q.query))); r != 0 {
+		return nil, pdhError("PdhOpenQuery", r)
+	}
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		q.close()
+		return nil, err
+	}
+	if r, _, _ := pdhAddEnglishCounter.Call(q.query, uintptr(unsafe.Pointer(p)), 0, uintptr(unsafe.Pointer(&q.counter))); r != 0 {
+		q.close()
+		return nil, pdhError("PdhAddEnglishCounter "+path, r)
+	}
+	// rates need a first sample to compare to
+	pdhCollectQueryData.Call(q.query)
+	return q, nil
+}
+
+func (q *pdhQuery) sample() (float64, error) {
+	if r, _, _ := pdhCollectQueryData.Call(q.query); r != 0 {
+		return 0, pdhError("PdhCollectQueryData", r)
+	}
+	var v pdhFmtCounterValue
+	if r, _, _ := pdhGetFormattedCounterValue.Call(q.counter, pdhFmtDouble, 0, uintptr(unsafe.Pointer(&v))); r != 0 {
+		return 0, pdhError("PdhGetFormattedCounterValue", r)
+	}
+	return v.value, nil
+}
+
+func (q *pdhQuery) close() {
+	pdhCloseQuery.Call(q.query)
+}
+
+// pdhSampler samples performance counters, each at its interval.
+type pdhSampler struct {
+	file     string
+	counters []pdhCounter
+}
+
+func newPdhSampler(file string, cs []pdhCounter) (input, error) {
+	if err := pdh.Load(); err != nil {
+		return nil, fmt.Errorf("cannot load pdh.dll: %v", err)
+	}
+	return pdhSampler{file: file, counters: cs}, nil
+}
+
+func (s pdhSampler) String() string {
+	return fmt.Sprintf("%d performance counters from %s", len(s.counters), s.file)
+}
+
+func (s pdhSampler) run(ctx context.Context, rs *results) error {
+	ch := make(chan string)
+	defer close(ch)
+	go rs.collect(ch)
+	var wg sync.WaitGroup
+	for _, c := range s.counters {
+		q, err := openPdhQuery(c.path)
+		if err != nil {
+			elog.Printf("performance counter %s: %v", c.path, err)
+			continue
+		}
+		wg.Add(1)
+		go func(c pdhCounter, q *pdhQuery) {
+			defer wg.Done()
+			defer q.close()
+			for sleep(ctx, c.interval) {
+				v, err := q.sample()
+				if err != nil {
+					elog.Printf("performance counter %s: %v", c.path, err)
+					continue
+				}
+				select {
+				case ch <- c.point(v).String():
+				case <-ctx.Done():
+				}
+			}
+		}(c, q)
+	}
+	wg.Wait()
+	return nil
+}
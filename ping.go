@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiURL returns the URL of another API of the server of the write
+// endpoint, keeping the credentials.
+func apiURL(endpoint, api string) (*url.URL, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse endpoint: %v", err)
+	}
+	// the other APIs of InfluxDB 2 are at the root too
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "api/v2/write"), "write") + api
+	u.RawQuery = ""
+	return u, nil
+}
+
+// pinger checks that the server of the endpoint is reachable with its
+// /ping API, and detects the InfluxDB version.
+type pinger struct {
+	endpoint  func() string
+	userAgent string
+	client    *http.Client
+
+	mux     sync.Mutex
+	err     error // result of the last ping
+	version string
+}
+
+func newPinger(endpoint func() string, userAgent string, client *http.Client) *pinger {
+	return &pinger{endpoint: endpoint, userAgent: userAgent, client: client}
+}
+
+func (p *pinger) ping(ctx context.Context) error {
+	u, err := apiURL(p.endpoint(), "ping")
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(forEndpoint(ctx), "GET", u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("cannot create ping request: %v", err)
+	}
+	if p.userAgent != "" {
+		req.Header.Set("User-Agent", p.userAgent)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot ping endpoint: %v", redactError(err))
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cannot ping endpoint: expected status 204, got %s", resp.Status)
+	}
+	version := resp.Header.Get("X-Influxdb-Version")
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if version != p.version {
+		if version == "" {
+			ilog.Printf("endpoint %s is up, not an InfluxDB server", u.Host)
+		} else {
+			ilog.Printf("endpoint %s is up, InfluxDB version %s (API v%d)", u.Host, version, apiVersion(version))
+		}
+		p.version = version
+	}
+	return nil
+}
+
+// apiVersion returns the major version of the InfluxDB API from the
+// server version, like "1.8.10" or "v2.7.1", or 0 if not known.
+func apiVersion(version string) int {
+	version = strings.TrimPrefix(version, "v")
+	if version == "" || version[0] < '1' || version[0] > '9' {
+		return 0
+	}
+	return int(version[0] - '0')
+}
+
+// influxVersion returns the InfluxDB version of the last successful ping,
+// empty if the server did not say it is InfluxDB.
+func (p *pinger) influxVersion() string {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.version
+}
+
+// check pings the endpoint and records the result, logging changes.
+func (p *pinger) check(ctx context.Context) error {
+	err := p.ping(ctx)
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if err != nil && p.err == nil {
+		elog.Print(err)
+		p.version = ""
+	} else if err == nil && p.err != nil {
+		ilog.Printf("endpoint is reachable again")
+	}
+	p.err = err
+	return err
+}
+
+func (p *pinger) run(ctx context.Context, interval time.Duration) {
+	for sleep(ctx, interval) {
+		p.check(ctx)
+	}
+}
+
+func (p *pinger) ready() bool {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	return p.err == nil
+}
+
+// readyChecks must all pass for /readyz of the admin address to succeed.
+var readyChecks []func() bool
+
+func serveReady(w http.ResponseWriter, r *http.Request) {
+	for _, ready := range readyChecks {
+		if !ready() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+	}
+	fmt.Fprintln(w, "ok")
+}
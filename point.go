@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// point is a parsed line of InfluxDB line protocol. Names and tag values
+// are unescaped; field values are kept in their line protocol form.
+type point struct {
+	measurement string
+	tags        []tag
+	fields      []field
+	time        int64
+	hasTime     bool
+	rp          string // retention policy to write to, if not the default
+}
+
+type tag struct {
+	key, value string
+}
+
+type field struct {
+	key, value string
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	keyUnescaper       = strings.NewReplacer(`\,`, ",", `\=`, "=", `\ `, " ")
+)
+
+// indexUnescaped returns the index of the first of chars in s that is not
+// preceded by a backslash, or -1.
+func indexUnescaped(s string, chars string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.IndexByte(chars, s[i]) >= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// splitUnescaped splits s at every unescaped sep.
+func splitUnescaped(s string, sep byte) []string {
+	var parts []string
+	for {
+		i := indexUnescaped(s, string(sep))
+		if i < 0 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:i])
+		s = s[i+1:]
+	}
+}
+
+func parsePoint(line string) (*point, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || line[0] == '#' {
+		return nil, errors.New("not a measurement")
+	}
+	i := indexUnescaped(line, " ")
+	if i < 0 {
+		return nil, errors.New("missing fields")
+	}
+	key, rest := line[:i], strings.TrimLeft(line[i+1:], " ")
+	p := &point{}
+	parts := splitUnescaped(key, ',')
+	p.measurement = keyUnescaper.Replace(parts[0])
+	if p.measurement == "" {
+		return nil, errors.New("missing measurement")
+	}
+	for _, kv := range parts[1:] {
+		j := indexUnescaped(kv, "=")
+		if j <= 0 {
+			return nil, fmt.Errorf("invalid tag %q", kv)
+		}
+		p.tags = append(p.tags, tag{keyUnescaper.Replace(kv[:j]), keyUnescaper.Replace(kv[j+1:])})
+	}
+	for {
+		j := indexUnescaped(rest, "=")
+		if j <= 0 {
+			return nil, fmt.Errorf("invalid field in %q", rest)
+		}
+		f := field{key: keyUnescaper.Replace(rest[:j])}
+		rest = rest[j+1:]
+		end := fieldValueEnd(rest)
+		if end < 0 {
+			return nil, errors.New("unterminated string field")
+		}
+		f.value = rest[:end]
+		if f.value == "" {
+			return nil, fmt.Errorf("missing value for field %q", f.key)
+		}
+		p.fields = append(p.fields, f)
+		rest = rest[end:]
+		if rest == "" || rest[0] == ' ' {
+			break
+		}
+		rest = rest[1:] // comma
+	}
+	if rest = strings.TrimSpace(rest); rest != "" {
+		t, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp: %v", err)
+		}
+		p.time, p.hasTime = t, true
+	}
+	return p, nil
+}
+
+// fieldValueEnd returns the length of the field value at the start of s,
+// or -1 if a string value is not terminated.
+func fieldValueEnd(s string) int {
+	if s == "" || s[0] != '"' {
+		if i := strings.IndexAny(s, ", "); i >= 0 {
+			return i
+		}
+		return len(s)
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+func (p *point) String() string {
+	var sb strings.Builder
+	sb.WriteString(measurementEscaper.Replace(p.measurement))
+	for _, t := range p.tags {
+		sb.WriteByte(',')
+		sb.WriteString(keyEscaper.Replace(t.key))
+		sb.WriteByte('=')
+		sb.WriteString(keyEscaper.Replace(t.value))
+	}
+	for i, f := range p.fields {
+		if i == 0 {
+			sb.WriteByte(' ')
+		} else {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(keyEscaper.Replace(f.key))
+		sb.WriteByte('=')
+		sb.WriteString(f.value)
+	}
+	if p.hasTime {
+		sb.WriteByte(' ')
+		sb.WriteString(strconv.FormatInt(p.time, 10))
+	}
+	return sb.String()
+}
+
+func (p *point) tag(key string) (string, bool) {
+	for _, t := range p.tags {
+		if t.key == key {
+			return t.value, true
+		}
+	}
+	return "", false
+}
+
+// setTag adds or replaces a tag, keeping tags sorted by key as recommended
+// by InfluxDB.
+func (p *point) setTag(key, value string) {
+	for i := range p.tags {
+		if p.tags[i].key == key {
+			p.tags[i].value = value
+			return
+		}
+		if p.tags[i].key > key {
+			p.tags = append(p.tags, tag{})
+			copy(p.tags[i+1:], p.tags[i:])
+			p.tags[i] = tag{key, value}
+			return
+		}
+	}
+	p.tags = append(p.tags, tag{key, value})
+}
+
+func (p *point) deleteTag(key string) {
+	for i := range p.tags {
+		if p.tags[i].key == key {
+			p.tags = append(p.tags[:i], p.tags[i+1:]...)
+			return
+		}
+	}
+}
+
+func (p *point) field(key string) (string, bool) {
+	for _, f := range p.fields {
+		if f.key == key {
+			return f.value, true
+		}
+	}
+	return "", false
+}
+
+func (p *point) setField(key, value string) {
+	for i := range p.fields {
+		if p.fields[i].key == key {
+			p.fields[i].value = value
+			return
+		}
+	}
+	p.fields = append(p.fields, field{key, value})
+}
+
+func (p *point) deleteField(key string) {
+	for i := range p.fields {
+		if p.fields[i].key == key {
+			p.fields = append(p.fields[:i], p.fields[i+1:]...)
+			return
+		}
+	}
+}
+
+// isStringField reports whether the line protocol value v is a string.
+func isStringField(v string) bool {
+	return len(v) >= 2 && v[0] == '"'
+}
+
+// fieldString returns the unquoted content of a string field value, or the
+// value itself for other types.
+func fieldString(v string) string {
+	if !isStringField(v) {
+		return v
+	}
+	return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(v[1 : len(v)-1])
+}
+
+// quoteField returns s as a line protocol string field value.
+func quoteField(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// fieldFloat returns the numeric value of a field value, if it is numeric.
+func fieldFloat(v string) (float64, bool) {
+	if isStringField(v) {
+		return 0, false
+	}
+	v = strings.TrimRight(v, "iu")
+	f, err := strconv.ParseFloat(v, 64)
+	return f, err == nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// openPty returns the master and slave ends of a new pseudo-terminal.
+// The master comes from posix_openpt, for which granting and unlocking are
+// no-ops on FreeBSD; the slave is found with TIOCGPTN. Output
+// post-processing is disabled on the slave so that lines are not
+// terminated by "\r\n".
+func openPty() (*os.File, *os.File, error) {
+	fd, _, e := syscall.Syscall(syscall.SYS_POSIX_OPENPT, syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0, 0)
+	if e != 0 {
+		return nil, nil, fmt.Errorf("posix_openpt: %v", e)
+	}
+	master := os.NewFile(fd, "/dev/ptmx")
+	var n uint32
+	if err := ioctl(master.Fd(), syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("cannot get pty number: %v", err)
+	}
+	slave, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	var t syscall.Termios
+	if err := ioctl(slave.Fd(), syscall.TIOCGETA, uintptr(unsafe.Pointer(&t))); err == nil {
+		t.Oflag &^= syscall.OPOST
+		ioctl(slave.Fd(), syscall.TIOCSETA, uintptr(unsafe.Pointer(&t)))
+	}
+	return master, slave, nil
+}
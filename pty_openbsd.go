@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// ptmget is the argument of the PTMGET ioctl on /dev/ptm.
+type ptmget struct {
+	cfd int32
+	sfd int32
+	cn  [16]byte
+	sn  [16]byte
+}
+
+// ptmGet is _IOR('t', 1, struct ptmget).
+const ptmGet = 0x40287401
+
+// openPty returns the master and slave ends of a new pseudo-terminal,
+// both opened by the PTMGET ioctl on /dev/ptm. Output post-processing is
+// disabled on the slave so that lines are not terminated by "\r\n".
+func openPty() (*os.File, *os.File, error) {
+	ptm, err := os.OpenFile("/dev/ptm", os.O_RDWR, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer ptm.Close()
+	var pt ptmget
+	if err := ioctl(ptm.Fd(), ptmGet, uintptr(unsafe.Pointer(&pt))); err != nil {
+		return nil, nil, fmt.Errorf("cannot get pty: %v", err)
+	}
+	syscall.CloseOnExec(int(pt.cfd))
+	syscall.CloseOnExec(int(pt.sfd))
+	master := os.NewFile(uintptr(pt.cfd), cstring(pt.cn[:]))
+	slave := os.NewFile(uintptr(pt.sfd), cstring(pt.sn[:]))
+	var t syscall.Termios
+	if err := ioctl(slave.Fd(), syscall.TIOCGETA, uintptr(unsafe.Pointer(&t))); err == nil {
+		t.Oflag &^= syscall.OPOST
+		ioctl(slave.Fd(), syscall.TIOCSETA, uintptr(unsafe.Pointer(&t)))
+	}
+	return master, slave, nil
+}
+
+// cstring returns the NUL-terminated string in b.
+func cstring(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
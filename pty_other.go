@@ -0,0 +1,13 @@
+//go:build !linux && !freebsd && !openbsd
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+)
+
+func attachPty(cmd *exec.Cmd) (io.ReadCloser, func(), error) {
+	return nil, nil, errors.New("pty allocation is not supported on this platform")
+}
@@ -0,0 +1,47 @@
+//go:build linux || freebsd || openbsd
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+func ioctl(fd, req, arg uintptr) error {
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg); e != 0 {
+		return e
+	}
+	return nil
+}
+
+// ptyReader reports the EIO returned once the slave side is closed as EOF.
+type ptyReader struct {
+	*os.File
+}
+
+func (p ptyReader) Read(b []byte) (int, error) {
+	n, err := p.File.Read(b)
+	var perr *os.PathError
+	if errors.As(err, &perr) && perr.Err == syscall.EIO {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// attachPty connects the standard output of cmd to a new pseudo-terminal,
+// which also becomes the controlling terminal of the child. The returned
+// reader is the master side; the returned function must be called once the
+// child has been started.
+func attachPty(cmd *exec.Cmd) (io.ReadCloser, func(), error) {
+	master, slave, err := openPty()
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot allocate pty: %v", err)
+	}
+	cmd.Stdout = slave
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 1}
+	return ptyReader{master}, func() { slave.Close() }, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// isFlux reports whether a query is written in Flux rather than InfluxQL.
+func isFlux(q string) bool {
+	return strings.Contains(q, "|>")
+}
+
+// runQuery runs a query against the server of the endpoint, with the same
+// client and credentials used to write, and prints the result to w:
+// InfluxQL results as a table per series, Flux results as the CSV returned
+// by the server.
+func runQuery(ctx context.Context, w io.Writer, client *http.Client, endpoint, userAgent, q string) error {
+	var (
+		req *http.Request
+		err error
+	)
+	if isFlux(q) {
+		u, err := apiURL(endpoint, "api/v2/query")
+		if err != nil {
+			return err
+		}
+		if eu, err := url.Parse(endpoint); err == nil && eu.Query().Get("org") != "" {
+			u.RawQuery = url.Values{"org": {eu.Query().Get("org")}}.Encode()
+		}
+		user := u.User
+		u.User = nil
+		if req, err = http.NewRequestWithContext(forEndpoint(ctx), "POST", u.String(), strings.NewReader(q)); err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/vnd.flux")
+		req.Header.Set("Accept", "application/csv")
+		if user != nil {
+			// InfluxDB 1.8 accepts its users as tokens
+			pass, _ := user.Password()
+			req.Header.Set("Authorization", "Token "+user.Username()+":"+pass)
+		}
+	} else {
+		qurl, err := queryURL(endpoint, q)
+		if err != nil {
+			return err
+		}
+		// POST allows queries that change the database too
+		if req, err = http.NewRequestWithContext(forEndpoint(ctx), "POST", qurl, nil); err != nil {
+			return err
+		}
+	}
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot query: %v", redactError(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("query failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if isFlux(q) {
+		_, err := io.Copy(w, resp.Body)
+		return err
+	}
+	return printInfluxQL(w, resp.Body)
+}
+
+// printInfluxQL prints the series of the JSON results of an InfluxQL query
+// as tables, each preceded by its name and tags.
+func printInfluxQL(w io.Writer, r io.Reader) error {
+	var res struct {
+		Results []struct {
+			Series []struct {
+				Name    string            `json:"name"`
+				Tags    map[string]string `json:"tags"`
+				Columns []string          `json:"columns"`
+				Values  [][]interface{}   `json:"values"`
+			} `json:"series"`
+			Error string `json:"error"`
+		} `json:"results"`
+		Error string `json:"error"`
+	}
+	d := json.NewDecoder(r)
+	d.UseNumber()
+	if err := d.Decode(&res); err != nil {
+		return fmt.Errorf("cannot decode query result: %v", err)
+	}
+	if res.Error != "" {
+		return fmt.Errorf("query failed: %s", res.Error)
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, r := range res.Results {
+		if r.Error != "" {
+			return fmt.Errorf("query failed: %s", r.Error)
+		}
+		for _, s := range r.Series {
+			fmt.Fprintf(tw, "name: %s\n", s.Name)
+			if len(s.Tags) > 0 {
+				var tags []string
+				for k, v := range s.Tags {
+					tags = append(tags, k+"="+v)
+				}
+				sort.Strings(tags)
+				fmt.Fprintf(tw, "tags: %s\n", strings.Join(tags, ", "))
+			}
+			fmt.Fprintln(tw, strings.Join(s.Columns, "\t"))
+			for _, row := range s.Values {
+				vals := make([]string, len(row))
+				for i, v := range row {
+					if v != nil {
+						vals[i] = fmt.Sprint(v)
+					}
+				}
+				fmt.Fprintln(tw, strings.Join(vals, "\t"))
+			}
+			fmt.Fprintln(tw)
+		}
+	}
+	return tw.Flush()
+}
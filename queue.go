@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+)
+
+// bufferBudget is the number of bytes shared by the queues of all the
+// destinations. When exceeded, the oldest batch of the largest queue is
+// dropped to make room for new ones.
+type bufferBudget struct {
+	mux    sync.Mutex
+	size   int
+	max    int
+	queues []*batchQueue
+}
+
+func newBufferBudget(max int) *bufferBudget {
+	return &bufferBudget{max: max}
+}
+
+// queue returns a new queue taking its room from the budget. Batches
+// dropped from a queue with a quota are counted for its destination.
+func (bb *bufferBudget) queue(q *quota) *batchQueue {
+	bb.mux.Lock()
+	defer bb.mux.Unlock()
+	bq := &batchQueue{budget: bb, quota: q}
+	bq.cond = sync.NewCond(&bb.mux)
+	bb.queues = append(bb.queues, bq)
+	return bq
+}
+
+// largest returns the queue holding the most bytes among the ones with
+// more than one batch, or nil if there is none.
+func (bb *bufferBudget) largest() *batchQueue {
+	var l *batchQueue
+	for _, q := range bb.queues {
+		if len(q.batches) > 1 && (l == nil || q.size > l.size) {
+			l = q
+		}
+	}
+	return l
+}
+
+// batchQueue holds the batches waiting to be submitted to one destination.
+type batchQueue struct {
+	budget  *bufferBudget
+	quota   *quota
+	cond    *sync.Cond
+	batches []pendingBatch
+	size    int
+}
+
+func (q *batchQueue) push(b pendingBatch) {
+	bb := q.budget
+	bb.mux.Lock()
+	defer bb.mux.Unlock()
+	q.batches = append(q.batches, b)
+	q.size += len(b.b)
+	bb.size += len(b.b)
+	for bb.size > bb.max {
+		l := bb.largest()
+		if l == nil {
+			break
+		}
+		l.dropOldest()
+	}
+	q.cond.Signal()
+}
+
+// dropOldest drops the oldest batch, with the budget locked.
+func (q *batchQueue) dropOldest() {
+	old := q.shift()
+	stats.Add("batches_dropped", 1)
+	stats.Add("bytes_dropped", int64(len(old.b)))
+	if q.quota != nil {
+		quotaStats.Add(q.quota.name+"_dropped", int64(bytes.Count(old.b, []byte{'\n'})))
+		elog.Printf("buffer limit of %d bytes reached, dropped oldest batch of %d bytes waiting for the quota of %s", q.budget.max, len(old.b), q.quota.name)
+		return
+	}
+	elog.Printf("buffer limit of %d bytes reached, dropped oldest batch of %d bytes", q.budget.max, len(old.b))
+}
+
+func (q *batchQueue) shift() pendingBatch {
+	b := q.batches[0]
+	q.batches[0] = pendingBatch{}
+	q.batches = q.batches[1:]
+	q.size -= len(b.b)
+	q.budget.size -= len(b.b)
+	return b
+}
+
+func (q *batchQueue) pop() pendingBatch {
+	q.budget.mux.Lock()
+	defer q.budget.mux.Unlock()
+	for len(q.batches) == 0 {
+		q.cond.Wait()
+	}
+	return q.shift()
+}
+
+// len returns the number of batches waiting.
+func (q *batchQueue) len() int {
+	q.budget.mux.Lock()
+	defer q.budget.mux.Unlock()
+	return len(q.batches)
+}
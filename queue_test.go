@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBufferBudgetShared(t *testing.T) {
+	bb := newBufferBudget(10)
+	qa := bb.queue(nil)
+	qb := bb.queue(&quota{name: "b"})
+	for i := 0; i < 3; i++ {
+		qa.push(pendingBatch{b: []byte("a=1\n")})
+	}
+	qb.push(pendingBatch{b: []byte("b=1\n")})
+	if bb.size > bb.max {
+		t.Fatalf("budget of %d bytes holds %d", bb.max, bb.size)
+	}
+	if n := qa.len(); n != 1 {
+		t.Errorf("largest queue kept %d batches, want 1", n)
+	}
+	if n := qb.len(); n != 1 {
+		t.Errorf("smaller queue kept %d batches, want 1", n)
+	}
+	if b := qa.pop(); !bytes.Equal(b.b, []byte("a=1\n")) {
+		t.Errorf("popped %q", b.b)
+	}
+	if bb.size != 4 {
+		t.Errorf("budget size is %d after pop, want 4", bb.size)
+	}
+}
+
+func TestBufferBudgetQuotaDrops(t *testing.T) {
+	bb := newBufferBudget(8)
+	q := bb.queue(&quota{name: "quota_test"})
+	for i := 0; i < 3; i++ {
+		q.push(pendingBatch{b: []byte("m=1\nm=2\n")})
+	}
+	v := quotaStats.Get("quota_test_dropped")
+	if v == nil || v.String() != "4" {
+		t.Errorf("quota drops counted as %v, want 4", v)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"expvar"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// quotaBuffer is the size shared by the queues of the destinations with a
+// quota in delay mode, when -max-buffer is not set: batches wait there
+// instead of blocking the pipeline shared with the other destinations.
+const quotaBuffer = 16 << 20
+
+// quotaStats counts the measurements dropped and the time batches were
+// delayed by the quota of each destination.
+var quotaStats = new(expvar.Map).Init()
+
+func init() {
+	stats.Set("quota", quotaStats)
+}
+
+// quota limits the points written per minute to a destination, with a
+// bucket of tokens refilled continuously. Over the quota, batches are
+// either delayed until the quota allows them or cut.
+type quota struct {
+	name      string
+	perMinute int
+	drop      bool
+
+	mux    sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func (q *quota) refill() {
+	now := time.Now()
+	q.tokens += now.Sub(q.last).Minutes() * float64(q.perMinute)
+	if q.tokens > float64(q.perMinute) {
+		q.tokens = float64(q.perMinute)
+	}
+	q.last = now
+}
+
+// reserve takes n points from the quota and returns how long to wait
+// before writing them.
+func (q *quota) reserve(n int) time.Duration {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	q.refill()
+	q.tokens -= float64(n)
+	if q.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-q.tokens / float64(q.perMinute) * float64(time.Minute))
+}
+
+// allow takes up to n points from the quota and returns how many can be
+// written now.
+func (q *quota) allow(n int) int {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	q.refill()
+	k := int(q.tokens)
+	if k > n {
+		k = n
+	}
+	if k < 0 {
+		k = 0
+	}
+	q.tokens -= float64(k)
+	return k
+}
+
+// limit returns the part of the batch b within the quota, after waiting
+// for it in delay mode, or nil if no line is left.
+func (q *quota) limit(ctx context.Context, b []byte) []byte {
+	n := bytes.Count(b, []byte{'\n'})
+	if !q.drop {
+		if wait := q.reserve(n); wait > 0 {
+			quotaStats.Add(q.name+"_delayed_ms", int64(wait/time.Millisecond))
+			sleep(ctx, wait)
+		}
+		return b
+	}
+	k := q.allow(n)
+	if k == n {
+		return b
+	}
+	stats.Add("quota_dropped", int64(n-k))
+	quotaStats.Add(q.name+"_dropped", int64(n-k))
+	if k == 0 {
+		return nil
+	}
+	end := 0
+	for i := 0; i < k; i++ {
+		end += bytes.IndexByte(b[end:], '\n') + 1
+	}
+	return b[:end]
+}
+
+// quotas holds the quotas of the destinations: the ones given for a
+// database or bucket, a DATABASE/RP or an endpoint host, and the default
+// for the others. Destinations matching the same key share its quota.
+type quotas struct {
+	def   int
+	drop  bool
+	specs map[string]int
+
+	mux    sync.Mutex
+	byName map[string]*quota
+}
+
+// newQuotas parses the "DEST N" specifications of -quota-for.
+func newQuotas(def int, mode string, specs []string) (*quotas, error) {
+	qs := &quotas{
+		def:    def,
+		specs:  make(map[string]int),
+		byName: make(map[string]*quota),
+	}
+	switch mode {
+	case "delay":
+	case "drop":
+		qs.drop = true
+	default:
+		return nil, fmt.Errorf("invalid quota mode %q: use delay or drop", mode)
+	}
+	for _, s := range specs {
+		ws := strings.Fields(s)
+		if len(ws) != 2 {
+			return nil, fmt.Errorf("invalid quota %q: expected DEST N", s)
+		}
+		n, err := strconv.Atoi(ws[1])
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid quota %q: expected a positive number of measurements per minute", s)
+		}
+		qs.specs[ws[0]] = n
+	}
+	return qs, nil
+}
+
+// forDest returns the quota of the destination writing to db and rp at
+// endpoint, or nil if it has none.
+func (qs *quotas) forDest(db, rp, endpoint string) *quota {
+	var keys []string
+	if db != "" {
+		if rp != "" {
+			keys = append(keys, db+"/"+rp)
+		}
+		keys = append(keys, db)
+	}
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		keys = append(keys, u.Host, u.Hostname())
+	}
+	for _, k := range keys {
+		if n, ok := qs.specs[k]; ok {
+			return qs.get(k, n)
+		}
+	}
+	if qs.def > 0 && len(keys) > 0 {
+		return qs.get(keys[0], qs.def)
+	}
+	return nil
+}
+
+func (qs *quotas) get(name string, perMinute int) *quota {
+	qs.mux.Lock()
+	defer qs.mux.Unlock()
+	q, ok := qs.byName[name]
+	if !ok {
+		q = &quota{
+			name:      name,
+			perMinute: perMinute,
+			drop:      qs.drop,
+			tokens:    float64(perMinute),
+			last:      time.Now(),
+		}
+		qs.byName[name] = q
+	}
+	return q
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// rcArgs returns the flags set on the command line, except secrets and
+// rc-script itself, followed by the commands, quoted for sh.
+func rcArgs() string {
+	var args []string
+	flag.Visit(func(f *flag.Flag) {
+		switch {
+		case f.Name == "rc-script":
+		case secretFlags[f.Name]:
+			elog.Printf("-%s left out of the rc script, use a file or an environment variable", f.Name)
+		case isBoolFlag(f):
+			args = append(args, "-"+f.Name+"="+f.Value.String())
+		default:
+			args = append(args, "-"+f.Name, shellQuote(f.Value.String()))
+		}
+	})
+	for _, a := range flag.Args() {
+		args = append(args, shellQuote(a))
+	}
+	return strings.Join(args, " ")
+}
+
+// writeRCScript writes an rc.d script for the BSDs that runs influxin with
+// the same arguments as this invocation. On FreeBSD the daemon(8) utility
+// detaches it, writes the pid file and restarts it if it exits; OpenBSD
+// rc.subr(8) backgrounds it directly.
+func writeRCScript(w io.Writer, system string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		exe = "/usr/local/bin/influxin"
+	}
+	switch system {
+	case "freebsd":
+		fmt.Fprintf(w, `#!/bin/sh
+
+# PROVIDE: influxin
+# REQUIRE: NETWORKING
+# KEYWORD: shutdown
+#
+# Add influxin_enable="YES" to /etc/rc.conf to start influxin at boot.
+
+. /etc/rc.subr
+
+name=influxin
+rcvar=influxin_enable
+
+load_rc_config $name
+
+: ${influxin_enable:="NO"}
+: ${influxin_user:="nobody"}
+: ${influxin_args:=%s}
+
+pidfile="/var/run/${name}.pid"
+command="/usr/sbin/daemon"
+command_args="-r -S -T ${name} -P ${pidfile} -u ${influxin_user} %s ${influxin_args}"
+
+run_rc_command "$1"
+`, shellQuote(rcArgs()), exe)
+	case "openbsd":
+		fmt.Fprintf(w, `#!/bin/ksh
+#
+# Enable with: rcctl enable influxin
+
+daemon="%s"
+daemon_flags=%s
+daemon_user="_influxin"
+
+. /etc/rc.d/rc.subr
+
+rc_bg=YES
+rc_reload=NO
+
+rc_cmd $1
+`, exe, shellQuote(rcArgs()))
+	default:
+		return fmt.Errorf("unsupported system %q, use one of: %s", system, strings.Join(enumFlags["rc-script"], ", "))
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+type rdnsEntry struct {
+	name    string
+	expires time.Time
+}
+
+// rdnsTransform adds a tag with the hostname of the IP address found in
+// another tag. Lookups, including failed ones, are cached for ttl.
+type rdnsTransform struct {
+	from, to string
+	ttl      time.Duration
+	lookup   func(string) ([]string, error)
+
+	mux   sync.Mutex
+	cache map[string]rdnsEntry
+}
+
+// newRdnsTransform parses a spec in the form "iptag=hosttag".
+func newRdnsTransform(spec string, ttl time.Duration) (*rdnsTransform, error) {
+	i := strings.IndexByte(spec, '=')
+	if i <= 0 || i == len(spec)-1 {
+		return nil, fmt.Errorf("invalid reverse DNS tags %q: expected iptag=hosttag", spec)
+	}
+	return &rdnsTransform{
+		from:   spec[:i],
+		to:     spec[i+1:],
+		ttl:    ttl,
+		lookup: net.LookupAddr,
+		cache:  make(map[string]rdnsEntry),
+	}, nil
+}
+
+func (r *rdnsTransform) String() string {
+	return fmt.Sprintf("resolve tag %s into %s", r.from, r.to)
+}
+
+func (r *rdnsTransform) resolve(ip string) string {
+	now := time.Now()
+	r.mux.Lock()
+	e, ok := r.cache[ip]
+	r.mux.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.name
+	}
+	var name string
+	names, err := r.lookup(ip)
+	if err != nil {
+		dlog.Printf("cannot resolve %s: %v", ip, err)
+	} else if len(names) > 0 {
+		name = strings.TrimSuffix(names[0], ".")
+	}
+	r.mux.Lock()
+	r.cache[ip] = rdnsEntry{name, now.Add(r.ttl)}
+	for k, e := range r.cache {
+		if now.After(e.expires) {
+			delete(r.cache, k)
+		}
+	}
+	r.mux.Unlock()
+	return name
+}
+
+func (r *rdnsTransform) apply(p *point) bool {
+	ip, ok := p.tag(r.from)
+	if !ok || net.ParseIP(ip) == nil {
+		return true
+	}
+	if name := r.resolve(ip); name != "" {
+		p.setTag(r.to, name)
+	}
+	return true
+}
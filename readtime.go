@@ -0,0 +1,37 @@
+package main
+
+import (
+	"time"
+)
+
+// readClock gives the time lines are read, never going backwards even if
+// the wall clock is adjusted while running.
+type readClock struct {
+	unit  time.Duration
+	start time.Time // with monotonic clock reading
+	last  int64
+}
+
+func newReadClock(unit time.Duration) *readClock {
+	return &readClock{unit: unit, start: clk.now()}
+}
+
+func (r *readClock) now() int64 {
+	t := r.start.Add(clk.now().Sub(r.start)+skew.offset()).UnixNano() / int64(r.unit)
+	if t < r.last {
+		t = r.last
+	}
+	r.last = t
+	return t
+}
+
+// stamp sets the read time on a line without timestamp. Lines that cannot
+// be parsed are returned unchanged.
+func (r *readClock) stamp(line string) string {
+	p, err := parsePoint(line)
+	if err != nil || p.hasTime {
+		return line
+	}
+	p.time, p.hasTime = r.now(), true
+	return p.String()
+}
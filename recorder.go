@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type recordedBatch struct {
+	at    time.Time
+	rp    string
+	batch []byte
+}
+
+// flightRecorder keeps the last flushed batches and the last error log
+// lines in memory, to be dumped when something went wrong.
+type flightRecorder struct {
+	mux     sync.Mutex
+	batches []recordedBatch
+	errors  []string
+	nextb   int // oldest entry, once the rings are full
+	nexte   int
+}
+
+func newFlightRecorder(nbatches, nerrors int) *flightRecorder {
+	return &flightRecorder{
+		batches: make([]recordedBatch, 0, nbatches),
+		errors:  make([]string, 0, nerrors),
+	}
+}
+
+func (r *flightRecorder) recordBatch(rp string, b []byte) {
+	if r == nil || cap(r.batches) == 0 {
+		return
+	}
+	rb := recordedBatch{at: time.Now(), rp: rp, batch: b}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if len(r.batches) < cap(r.batches) {
+		r.batches = append(r.batches, rb)
+		return
+	}
+	r.batches[r.nextb] = rb
+	r.nextb = (r.nextb + 1) % len(r.batches)
+}
+
+// Write records a line of the error log.
+func (r *flightRecorder) Write(b []byte) (int, error) {
+	if cap(r.errors) == 0 {
+		return len(b), nil
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if len(r.errors) < cap(r.errors) {
+		r.errors = append(r.errors, string(b))
+	} else {
+		r.errors[r.nexte] = string(b)
+		r.nexte = (r.nexte + 1) % len(r.errors)
+	}
+	return len(b), nil
+}
+
+// dump writes the recorded errors and batches, oldest first.
+func (r *flightRecorder) dump(w io.Writer) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	fmt.Fprintf(w, "# last %d errors\n", len(r.errors))
+	for i := range r.errors {
+		if _, err := io.WriteString(w, r.errors[(r.nexte+i)%len(r.errors)]); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(w, "\n# last %d batches\n", len(r.batches))
+	for i := range r.batches {
+		b := r.batches[(r.nextb+i)%len(r.batches)]
+		fmt.Fprintf(w, "\n# batch flushed at %s", b.at.Format(time.RFC3339Nano))
+		if b.rp != "" {
+			fmt.Fprintf(w, " to retention policy %s", b.rp)
+		}
+		fmt.Fprintf(w, ", %d bytes\n", len(b.batch))
+		if _, err := w.Write(b.batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *flightRecorder) dumpFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("cannot create flight recorder dump: %v", err)
+	}
+	if err := r.dump(f); err != nil {
+		f.Close()
+		return fmt.Errorf("cannot write flight recorder dump: %v", err)
+	}
+	return f.Close()
+}
+
+// serve dumps the recorder to path on SIGQUIT and on /debug/flight of the
+// admin listener.
+func (r *flightRecorder) serve(path string) {
+	http.HandleFunc("/debug/flight", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := r.dump(w); err != nil {
+			elog.Printf("cannot write flight recorder dump: %v", err)
+		}
+	})
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGQUIT)
+	go func() {
+		for range quit {
+			if err := r.dumpFile(path); err != nil {
+				elog.Print(err)
+				continue
+			}
+			ilog.Printf("flight recorder dumped to %s", path)
+		}
+	}()
+}
+
+// recentErrors returns the recorded error log lines, oldest first.
+func (r *flightRecorder) recentErrors() []string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	errs := make([]string, len(r.errors))
+	for i := range r.errors {
+		errs[i] = r.errors[(r.nexte+i)%len(r.errors)]
+	}
+	return errs
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+const redacted = "xxxxx"
+
+// secretParams are query parameters carrying credentials.
+var secretParams = []string{"p", "password", "token"}
+
+// redactURL hides the password in the userinfo and the credentials in the
+// query of rawurl, if any.
+func redactURL(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return rawurl
+	}
+	q := u.Query()
+	redact := false
+	for _, p := range secretParams {
+		if q.Get(p) != "" {
+			q.Set(p, redacted)
+			redact = true
+		}
+	}
+	if redact {
+		u.RawQuery = q.Encode()
+	}
+	return u.Redacted()
+}
+
+// redactError hides credentials from the URL of failed HTTP requests.
+func redactError(err error) error {
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		uerr.URL = redactURL(uerr.URL)
+	}
+	return err
+}
+
+// redactDump hides credentials in a dumped HTTP request or response: the
+// authorization headers and the query of the request line.
+func redactDump(dump []byte) []byte {
+	lines := bytes.Split(dump, []byte("\r\n"))
+	for i, line := range lines {
+		if len(line) == 0 {
+			break // end of headers
+		}
+		if i == 0 {
+			parts := strings.SplitN(string(line), " ", 3)
+			if len(parts) == 3 && strings.Contains(parts[1], "?") {
+				parts[1] = redactURL(parts[1])
+				lines[i] = []byte(strings.Join(parts, " "))
+			}
+			continue
+		}
+		name := strings.ToLower(string(line[:bytes.IndexByte(append(line, ':'), ':')]))
+		if name == "authorization" || name == "proxy-authorization" {
+			lines[i] = append(line[:len(name)+1:len(name)+1], " "+redacted...)
+		}
+	}
+	return bytes.Join(lines, []byte("\r\n"))
+}
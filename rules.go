@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// transform modifies a point in place. It returns false if the point must
+// be dropped.
+type transform interface {
+	apply(p *point) bool
+}
+
+// condition matches a point on its measurement, a tag or a field.
+type condition struct {
+	subject string // "measurement", "tag" or "field"
+	key     string
+	op      string
+	value   string
+	num     float64
+	re      *regexp.Regexp
+}
+
+var conditionOps = []string{"!=", "^=", "$=", "~=", "<=", ">=", "=", "<", ">"}
+
+func parseCondition(s string) (*condition, error) {
+	i := strings.IndexAny(s, "!^$~<>=")
+	if i <= 0 {
+		return nil, fmt.Errorf("missing operator in condition %q", s)
+	}
+	c := &condition{}
+	for _, op := range conditionOps {
+		if strings.HasPrefix(s[i:], op) {
+			c.op = op
+			break
+		}
+	}
+	if c.op == "" {
+		return nil, fmt.Errorf("invalid operator in condition %q", s)
+	}
+	subject := s[:i]
+	c.value = s[i+len(c.op):]
+	switch {
+	case subject == "measurement":
+		c.subject = subject
+	case strings.HasPrefix(subject, "tag."):
+		c.subject, c.key = "tag", subject[len("tag."):]
+	case strings.HasPrefix(subject, "field."):
+		c.subject, c.key = "field", subject[len("field."):]
+	default:
+		return nil, fmt.Errorf("invalid subject %q, use measurement, tag.NAME or field.NAME", subject)
+	}
+	switch c.op {
+	case "~=":
+		re, err := regexp.Compile(c.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression in condition %q: %v", s, err)
+		}
+		c.re = re
+	case "<", ">", "<=", ">=":
+		num, err := strconv.ParseFloat(c.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number in condition %q: %v", s, err)
+		}
+		c.num = num
+	}
+	return c, nil
+}
+
+func (c *condition) match(p *point) bool {
+	var (
+		val string
+		ok  bool
+	)
+	switch c.subject {
+	case "measurement":
+		val, ok = p.measurement, true
+	case "tag":
+		val, ok = p.tag(c.key)
+	case "field":
+		val, ok = p.field(c.key)
+		if ok {
+			switch c.op {
+			case "<", ">", "<=", ">=":
+				f, isNum := fieldFloat(val)
+				if !isNum {
+					return false
+				}
+				switch c.op {
+				case "<":
+					return f < c.num
+				case ">":
+					return f > c.num
+				case "<=":
+					return f <= c.num
+				}
+				return f >= c.num
+			}
+			val = fieldString(val)
+		}
+	}
+	if !ok {
+		return c.op == "!="
+	}
+	switch c.op {
+	case "=":
+		return val == c.value
+	case "!=":
+		return val != c.value
+	case "^=":
+		return strings.HasPrefix(val, c.value)
+	case "$=":
+		return strings.HasSuffix(val, c.value)
+	case "~=":
+		return c.re.MatchString(val)
+	}
+	return false
+}
+
+// rule applies an action to the points matching all its conditions.
+type rule struct {
+	text   string
+	action string
+	key    string
+	value  string
+	conds  []*condition
+	globs  []string          // field names of drop-fields and keep-fields
+	enum   map[string]string // lowercase text to field value, for enum
+}
+
+// parseRule parses a rule in the form "ACTION [ARGUMENT] CONDITION...".
+// The actions are:
+//
+//	drop                          drops the point
+//	tag KEY=VALUE                 sets a tag
+//	untag KEY                     removes a tag
+//	rp NAME                       writes the point to the retention policy NAME
+//	drop-fields GLOBS             removes the fields matching comma separated globs
+//	keep-fields GLOBS             keeps only the fields matching comma separated globs
+//	field-to-tag KEY              turns a field into a tag
+//	tag-to-field KEY              turns a tag into a field
+//	enum KEY:TEXT=NUMBER,...      replaces the text of a string field with a number
+//
+// Conditions are "measurement", "tag.KEY" or "field.KEY" followed by an
+// operator and a value, and must all match for the action to be applied.
+func parseRule(s string) (*rule, error) {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty rule")
+	}
+	r := &rule{text: s, action: words[0]}
+	words = words[1:]
+	switch r.action {
+	case "drop":
+	case "tag", "untag", "rp", "drop-fields", "keep-fields", "field-to-tag", "tag-to-field", "enum":
+		if len(words) == 0 {
+			return nil, fmt.Errorf("missing argument for %s in rule %q", r.action, s)
+		}
+		r.key = words[0]
+		if r.action == "tag" {
+			i := strings.IndexByte(r.key, '=')
+			if i <= 0 {
+				return nil, fmt.Errorf("invalid tag %q in rule %q: expected key=value", r.key, s)
+			}
+			r.key, r.value = r.key[:i], r.key[i+1:]
+		}
+		if r.action == "enum" {
+			var err error
+			if r.key, r.enum, err = parseEnum(r.key); err != nil {
+				return nil, fmt.Errorf("invalid enum in rule %q: %v", s, err)
+			}
+		}
+		if strings.HasSuffix(r.action, "-fields") {
+			r.globs = strings.Split(r.key, ",")
+			for _, g := range r.globs {
+				if _, err := path.Match(g, ""); err != nil {
+					return nil, fmt.Errorf("invalid field name %q in rule %q: %v", g, s, err)
+				}
+			}
+		}
+		words = words[1:]
+	default:
+		return nil, fmt.Errorf("unknown action %q in rule %q", r.action, s)
+	}
+	for _, w := range words {
+		c, err := parseCondition(w)
+		if err != nil {
+			return nil, err
+		}
+		r.conds = append(r.conds, c)
+	}
+	return r, nil
+}
+
+func (r *rule) String() string {
+	return "rule " + r.text
+}
+
+func (r *rule) apply(p *point) bool {
+	for _, c := range r.conds {
+		if !c.match(p) {
+			return true
+		}
+	}
+	switch r.action {
+	case "drop":
+		return false
+	case "tag":
+		p.setTag(r.key, r.value)
+	case "untag":
+		p.deleteTag(r.key)
+	case "rp":
+		p.rp = r.key
+	case "drop-fields", "keep-fields":
+		keep := r.action == "keep-fields"
+		fields := p.fields[:0]
+		for _, f := range p.fields {
+			if matchGlobs(r.globs, f.key) == keep {
+				fields = append(fields, f)
+			}
+		}
+		p.fields = fields
+		// a point must have at least one field
+		return len(p.fields) > 0
+	case "field-to-tag":
+		v, ok := p.field(r.key)
+		if !ok {
+			return true
+		}
+		if !isStringField(v) {
+			v = strings.TrimRight(v, "iu")
+		}
+		p.deleteField(r.key)
+		if v = fieldString(v); v != "" {
+			p.setTag(r.key, v)
+		}
+		return len(p.fields) > 0
+	case "enum":
+		v, ok := p.field(r.key)
+		if !ok || !isStringField(v) {
+			return true
+		}
+		if n, ok := r.enum[strings.ToLower(fieldString(v))]; ok {
+			p.setField(r.key, n)
+			return true
+		}
+		// a string would conflict with the type of the mapped values
+		stats.Add("enum_unmapped", 1)
+		dlog.Printf("no value for %s=%s in rule %q, dropping the field", r.key, v, r.text)
+		p.deleteField(r.key)
+		return len(p.fields) > 0
+	case "tag-to-field":
+		if v, ok := p.tag(r.key); ok {
+			p.deleteTag(r.key)
+			p.setField(r.key, quoteField(v))
+		}
+	}
+	return true
+}
+
+// parseEnum parses "KEY:TEXT=NUMBER,..." and returns the key and the field
+// values by lowercase text.
+func parseEnum(s string) (string, map[string]string, error) {
+	i := strings.IndexByte(s, ':')
+	if i <= 0 {
+		return "", nil, fmt.Errorf("expected KEY:TEXT=NUMBER,... in %q", s)
+	}
+	key, enum := s[:i], make(map[string]string)
+	for _, kv := range strings.Split(s[i+1:], ",") {
+		j := strings.IndexByte(kv, '=')
+		if j <= 0 {
+			return "", nil, fmt.Errorf("expected TEXT=NUMBER in %q", kv)
+		}
+		text, num := kv[:j], kv[j+1:]
+		if _, err := strconv.ParseInt(num, 10, 64); err == nil {
+			num += "i"
+		} else if _, err := strconv.ParseFloat(num, 64); err != nil {
+			return "", nil, fmt.Errorf("invalid number %q for %s", num, text)
+		}
+		enum[strings.ToLower(text)] = num
+	}
+	return key, enum, nil
+}
+
+// matchGlobs reports whether name matches any of globs.
+func matchGlobs(globs []string, name string) bool {
+	for _, g := range globs {
+		if ok, _ := path.Match(g, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// routes returns the retention policies the rules route points to,
+// starting with the default one.
+func routes(ts []transform) []string {
+	rps := []string{""}
+	seen := map[string]bool{"": true}
+	for _, t := range ts {
+		if r, ok := t.(*rule); ok && r.action == "rp" && !seen[r.key] {
+			seen[r.key] = true
+			rps = append(rps, r.key)
+		}
+	}
+	return rps
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tagSanitizer removes control characters from tag values and truncates
+// them to maxLen bytes, if maxLen is positive. Tags left with an empty key
+// or value, rejected by InfluxDB, are removed and counted.
+type tagSanitizer struct {
+	strip  bool
+	maxLen int
+}
+
+func (t tagSanitizer) String() string {
+	s := "sanitize tags"
+	if t.maxLen > 0 {
+		s += fmt.Sprintf(" to %d bytes", t.maxLen)
+	}
+	return s
+}
+
+func stripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// truncate cuts s to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func (t tagSanitizer) apply(p *point) bool {
+	tags := p.tags[:0]
+	for _, tag := range p.tags {
+		if t.strip {
+			tag.value = stripControl(tag.value)
+		}
+		if t.maxLen > 0 {
+			tag.value = truncate(tag.value, t.maxLen)
+		}
+		if tag.key == "" || tag.value == "" {
+			stats.Add("tags_emptied", 1)
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	p.tags = tags
+	return true
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// measurementSchema is the expected form of a measurement: the tags it
+// must have and the fields it can have, with their types.
+type measurementSchema struct {
+	tags   []string
+	fields map[string]string
+}
+
+// schema maps command names to the measurements they can produce.
+type schema map[string]map[string]*measurementSchema
+
+var fieldTypes = []string{"float", "integer", "unsigned", "string", "boolean"}
+
+// fieldType returns the type of a line protocol field value.
+func fieldType(v string) string {
+	switch {
+	case isStringField(v):
+		return "string"
+	case strings.HasSuffix(v, "i"):
+		return "integer"
+	case strings.HasSuffix(v, "u"):
+		return "unsigned"
+	}
+	switch v {
+	case "t", "T", "true", "True", "TRUE", "f", "F", "false", "False", "FALSE":
+		return "boolean"
+	}
+	return "float"
+}
+
+// readSchema reads a schema file. Each line declares a measurement of a
+// command, like:
+//
+//	collector: measurement=cpu tags=host,cpu fields=usage:float,count:integer
+//
+// Empty lines and lines starting with # are ignored.
+func readSchema(path string) (schema, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open schema: %v", err)
+	}
+	defer f.Close()
+	s := make(schema)
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			return nil, fmt.Errorf("%s:%d: expected 'command: measurement=NAME ...'", path, n)
+		}
+		name := strings.TrimSpace(line[:i])
+		var (
+			measurement string
+			ms          = &measurementSchema{fields: make(map[string]string)}
+		)
+		for _, w := range strings.Fields(line[i+1:]) {
+			j := strings.IndexByte(w, '=')
+			if j <= 0 {
+				return nil, fmt.Errorf("%s:%d: invalid %q, expected key=value", path, n, w)
+			}
+			key, val := w[:j], w[j+1:]
+			switch key {
+			case "measurement":
+				measurement = val
+			case "tags":
+				ms.tags = strings.Split(val, ",")
+			case "fields":
+				for _, fd := range strings.Split(val, ",") {
+					k := strings.IndexByte(fd, ':')
+					if k <= 0 || !containsString(fieldTypes, fd[k+1:]) {
+						return nil, fmt.Errorf("%s:%d: invalid field %q, expected name:TYPE with TYPE one of %s", path, n, fd, strings.Join(fieldTypes, ", "))
+					}
+					ms.fields[fd[:k]] = fd[k+1:]
+				}
+			default:
+				return nil, fmt.Errorf("%s:%d: unknown key %q, use measurement, tags or fields", path, n, key)
+			}
+		}
+		if measurement == "" {
+			return nil, fmt.Errorf("%s:%d: missing measurement", path, n)
+		}
+		if s[name] == nil {
+			s[name] = make(map[string]*measurementSchema)
+		}
+		s[name][measurement] = ms
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read schema: %v", err)
+	}
+	return s, nil
+}
+
+func containsString(ss []string, s string) bool {
+	for i := range ss {
+		if ss[i] == s {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns the first violation of the schema by p, if any.
+func (ms *measurementSchema) check(p *point) error {
+	for _, t := range ms.tags {
+		if _, ok := p.tag(t); !ok {
+			return fmt.Errorf("measurement %s: missing tag %s", p.measurement, t)
+		}
+	}
+	for _, f := range p.fields {
+		typ, ok := ms.fields[f.key]
+		if !ok {
+			return fmt.Errorf("measurement %s: unexpected field %s", p.measurement, f.key)
+		}
+		if got := fieldType(f.value); got != typ {
+			return fmt.Errorf("measurement %s: field %s is %s, expected %s", p.measurement, f.key, got, typ)
+		}
+	}
+	return nil
+}
+
+// schemaCheck validates the lines of a command against its schema.
+type schemaCheck struct {
+	measurements map[string]*measurementSchema
+	drop         bool
+	violations   int // since the last log
+	lastLog      time.Time
+}
+
+// check reports whether the line of command name can be forwarded.
+// Violations are logged at most once per minute.
+func (s *schemaCheck) check(name, line string) bool {
+	p, err := parsePoint(line)
+	if err == nil {
+		ms, ok := s.measurements[p.measurement]
+		if !ok {
+			err = fmt.Errorf("unexpected measurement %s", p.measurement)
+		} else {
+			err = ms.check(p)
+		}
+	}
+	if err == nil {
+		return true
+	}
+	stats.Add("schema_violations", 1)
+	s.violations++
+	if time.Since(s.lastLog) >= time.Minute {
+		elog.Printf("command %s violates its schema: %v (%d violations since the last report)", name, err, s.violations)
+		s.violations = 0
+		s.lastLog = time.Now()
+	}
+	return !s.drop
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxScriptSize is the largest script that is downloaded.
+const maxScriptSize = 10 << 20
+
+// scriptLibrary resolves the commands that reference scripts instead of
+// programs: "@NAME" is a script of the directory and a http or https URL
+// is downloaded to the directory. Both can end with "#sha256=HEX" to
+// verify the content of the script; URLs must.
+type scriptLibrary struct {
+	dir    string
+	client *http.Client
+}
+
+// isScriptRef reports whether a command name references a script.
+func isScriptRef(name string) bool {
+	return strings.HasPrefix(name, "@") || strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")
+}
+
+// splitChecksum returns the reference without its "#sha256=HEX" suffix
+// and the expected checksum, if any.
+func splitChecksum(ref string) (string, string, error) {
+	i := strings.LastIndexByte(ref, '#')
+	if i < 0 {
+		return ref, "", nil
+	}
+	sum := ref[i+1:]
+	if !strings.HasPrefix(sum, "sha256=") {
+		return "", "", fmt.Errorf("invalid checksum %q, expected sha256=HEX", sum)
+	}
+	sum = strings.ToLower(strings.TrimPrefix(sum, "sha256="))
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != sha256.Size {
+		return "", "", fmt.Errorf("invalid sha256 checksum %q", sum)
+	}
+	return ref[:i], sum, nil
+}
+
+// resolve returns the path of the script referenced by ref, downloading
+// it if it is not already in the directory with the expected checksum.
+func (l *scriptLibrary) resolve(ctx context.Context, ref string) (string, error) {
+	if l.dir == "" {
+		return "", fmt.Errorf("script %s requires -script-dir", ref)
+	}
+	ref, sum, err := splitChecksum(ref)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(ref, "@") {
+		name := filepath.FromSlash(ref[1:])
+		if name == "" || filepath.IsAbs(name) || strings.HasPrefix(filepath.Clean(name), "..") {
+			return "", fmt.Errorf("invalid script name %q", ref)
+		}
+		file := filepath.Join(l.dir, name)
+		if sum == "" {
+			_, err := os.Stat(file)
+			return file, err
+		}
+		if err := verifyChecksum(file, sum); err != nil {
+			return "", err
+		}
+		return file, nil
+	}
+	if sum == "" {
+		return "", fmt.Errorf("script %s requires a #sha256=HEX checksum", redactURL(ref))
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	base := path.Base(u.Path)
+	if base == "/" || base == "." {
+		return "", fmt.Errorf("script %s has no file name", redactURL(ref))
+	}
+	// the checksum in the name keeps the versions of a script apart
+	file := filepath.Join(l.dir, sum[:12]+"-"+base)
+	if verifyChecksum(file, sum) == nil {
+		dlog.Printf("script %s is up to date in %s", redactURL(ref), file)
+		return file, nil
+	}
+	if err := l.fetch(ctx, ref, file, sum); err != nil {
+		return "", fmt.Errorf("cannot fetch script %s: %v", redactURL(ref), err)
+	}
+	ilog.Printf("fetched script %s to %s", redactURL(ref), file)
+	return file, nil
+}
+
+// fetch downloads the script to file, if its checksum matches.
+func (l *scriptLibrary) fetch(ctx context.Context, rawurl, file, sum string) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", rawurl, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return redactError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return fmt.Errorf("expected status 2xx, got %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxScriptSize+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > maxScriptSize {
+		return fmt.Errorf("larger than %d bytes", maxScriptSize)
+	}
+	if got := sha256.Sum256(body); hex.EncodeToString(got[:]) != sum {
+		return fmt.Errorf("checksum mismatch: got sha256=%x", got)
+	}
+	if err := os.MkdirAll(l.dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(l.dir, ".fetch-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// verifyChecksum returns an error if the file does not have the sha256
+// checksum sum.
+func verifyChecksum(file, sum string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != sum {
+		return fmt.Errorf("checksum mismatch of %s: got sha256=%s", file, got)
+	}
+	return nil
+}
+
+// resolveScripts replaces the script references of the commands with the
+// path of the scripts.
+func (c cmds) resolveScripts(ctx context.Context, l *scriptLibrary) error {
+	for i := range c {
+		ref := c[i].name
+		if !isScriptRef(ref) {
+			continue
+		}
+		file, err := l.resolve(ctx, ref)
+		if err != nil {
+			return err
+		}
+		c[i].name = file
+		// the line of a command file starts with the reference
+		if strings.HasPrefix(c[i].line, ref) {
+			c[i].line = file + c[i].line[len(ref):]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// shells lists the supported shells and their executable.
+var shells = map[string]string{
+	"sh":         "/bin/sh",
+	"cmd":        "cmd.exe",
+	"powershell": "powershell.exe",
+}
+
+// commandLine returns the command and its arguments as a single line to be
+// interpreted by a shell.
+func (c *cmd) commandLine() string {
+	if c.line != "" {
+		return c.line
+	}
+	return strings.TrimSpace(c.name + " " + strings.Join(c.args, " "))
+}
+
+// shellCommand returns a command running line with the given shell. The
+// line is passed to the shell as is, without further quoting.
+func shellCommand(ctx context.Context, shell, line string) (*exec.Cmd, error) {
+	switch shell {
+	case "sh":
+		return exec.CommandContext(ctx, shells[shell], "-c", line), nil
+	case "cmd":
+		c := exec.CommandContext(ctx, shells[shell], "/S", "/C", line)
+		setCmdLine(c, fmt.Sprintf(`%s /S /C "%s"`, shells[shell], line))
+		return c, nil
+	case "powershell":
+		return exec.CommandContext(ctx, shells[shell], "-NoProfile", "-NonInteractive", "-Command", line), nil
+	}
+	return nil, fmt.Errorf("unknown shell %q", shell)
+}
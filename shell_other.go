@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+import "os/exec"
+
+// setCmdLine is only needed on Windows, elsewhere arguments are passed as
+// they are.
+func setCmdLine(c *exec.Cmd, line string) {}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setCmdLine passes line to the command without escaping, as cmd.exe does
+// not follow the quoting rules of other programs.
+func setCmdLine(c *exec.Cmd, line string) {
+	c.SysProcAttr = &syscall.SysProcAttr{CmdLine: line}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// clockSkew tracks the difference between the clock of the InfluxDB server,
+// as given by the Date header of its responses, and the local clock.
+type clockSkew struct {
+	max     time.Duration // warn when the skew is larger than this
+	correct bool          // correct generated timestamps by the skew
+
+	skew int64 // nanoseconds, updated atomically
+	over int32 // 1 while the skew is over max
+}
+
+// skew is the clock skew check, if enabled.
+var skew *clockSkew
+
+// observe updates the skew from a response to a request sent and received
+// at the given local times. The Date header has a resolution of one second.
+func (c *clockSkew) observe(resp *http.Response, sent, received time.Time) {
+	if c == nil {
+		return
+	}
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+	// the server time is taken somewhere between sending and receiving
+	local := sent.Add(received.Sub(sent) / 2)
+	d := date.Sub(local).Round(time.Second)
+	atomic.StoreInt64(&c.skew, int64(d))
+	stats.Set("clock_skew_seconds", expvarFloat(d.Seconds()))
+	over := d > c.max || d < -c.max
+	if over && atomic.CompareAndSwapInt32(&c.over, 0, 1) {
+		if d > 0 {
+			elog.Printf("local clock is %v behind the InfluxDB server clock", d)
+		} else {
+			elog.Printf("local clock is %v ahead of the InfluxDB server clock", -d)
+		}
+	} else if !over && atomic.CompareAndSwapInt32(&c.over, 1, 0) {
+		ilog.Printf("local clock is again in sync with the InfluxDB server clock")
+	}
+}
+
+// offset returns the correction to apply to the local time.
+func (c *clockSkew) offset() time.Duration {
+	if c == nil || !c.correct || atomic.LoadInt32(&c.over) == 0 {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&c.skew))
+}
+
+// now returns the current time, corrected by the skew if requested.
+func (c *clockSkew) now() time.Time {
+	return clk.now().Add(c.offset())
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime/debug"
+)
+
+// smallDefaults replace the defaults of some flags with -small, for devices
+// with little memory.
+var smallDefaults = map[string]string{
+	"nbatch":          "20",
+	"max-buffer":      "1",
+	"dedup-size":      "1000",
+	"flight-errors":   "10",
+	"debug-file-size": "1",
+	"debug-file-keep": "1",
+}
+
+// applySmall sets the flags not set on the command line or in the
+// environment to their -small defaults, and makes the garbage collector
+// return memory sooner.
+func applySmall(set func(name string) bool) error {
+	for name, value := range smallDefaults {
+		if set(name) {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("cannot set -%s for -small: %v", name, err)
+		}
+	}
+	debug.SetGCPercent(25)
+	return nil
+}
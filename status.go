@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// cmdStatus is the state of a running command, shown by the admin UI.
+type cmdStatus struct {
+	ID        int
+	Name      string
+	Running   bool
+	Started   time.Time
+	Restarts  int
+	LastError string
+
+	cancel context.CancelFunc // stops the current execution
+}
+
+var (
+	statusMux sync.Mutex
+	statuses  = make(map[int]*cmdStatus)
+)
+
+// cmdStarted records a new execution of command id, that can be stopped
+// with cancel.
+func cmdStarted(id int, name string, cancel context.CancelFunc) {
+	statusMux.Lock()
+	defer statusMux.Unlock()
+	s, ok := statuses[id]
+	if !ok {
+		s = &cmdStatus{ID: id}
+		statuses[id] = s
+	} else {
+		s.Restarts++
+	}
+	s.Name, s.Running, s.Started, s.cancel = name, true, time.Now(), cancel
+}
+
+func cmdStopped(id int, err error) {
+	statusMux.Lock()
+	defer statusMux.Unlock()
+	s, ok := statuses[id]
+	if !ok {
+		return
+	}
+	s.Running = false
+	if err != nil {
+		s.LastError = err.Error()
+	}
+}
+
+// cmdForget removes command id once it will not be run again.
+func cmdForget(id int) {
+	statusMux.Lock()
+	defer statusMux.Unlock()
+	delete(statuses, id)
+}
+
+// cmdStatuses returns a copy of the state of the commands, sorted by id.
+func cmdStatuses() []cmdStatus {
+	statusMux.Lock()
+	defer statusMux.Unlock()
+	ss := make([]cmdStatus, 0, len(statuses))
+	for id := 0; len(ss) < len(statuses); id++ {
+		if s, ok := statuses[id]; ok {
+			ss = append(ss, *s)
+		}
+	}
+	return ss
+}
+
+// cmdRestart stops the current execution of command id, which is then
+// started again. It returns false if there is no such command.
+func cmdRestart(id int) bool {
+	statusMux.Lock()
+	defer statusMux.Unlock()
+	s, ok := statuses[id]
+	if !ok || !s.Running {
+		return false
+	}
+	s.cancel()
+	return true
+}
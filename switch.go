@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// pending returns the number of batches submitted but not yet delivered.
+func (s *submitter) pending() int {
+	n := len(s.ch) + int(atomic.LoadInt64(&s.inflight))
+	if s.queue != nil {
+		n += s.queue.len()
+	}
+	return n
+}
+
+// drain waits until all submitted batches were delivered, or the timeout
+// is over. It returns false on timeout.
+func (s *submitter) drain(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	idle := 0
+	for idle < 2 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+		if s.pending() == 0 {
+			idle++
+		} else {
+			idle = 0
+		}
+	}
+	return true
+}
+
+// submitterList is a list of submitters that grows while measurements are
+// collected, as mapped databases are first written to.
+type submitterList struct {
+	mux  sync.Mutex
+	subs []*submitter
+}
+
+func (l *submitterList) add(s *submitter) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.subs = append(l.subs, s)
+}
+
+func (l *submitterList) all() []*submitter {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	return append([]*submitter(nil), l.subs...)
+}
+
+// endpointSwitcher changes the endpoint of the submitters at runtime, on
+// request of the admin API. The forwarders that follow the endpoint, to
+// mapped databases, switch with them; the others, like Kapacitor, are
+// left alone.
+type endpointSwitcher struct {
+	rs         *results
+	submitters []*submitter
+	forwarders *submitterList
+	normalize  func(rawurl string) (string, error) // like -endpoint at startup
+	token      string
+	timeout    time.Duration // for draining to the old endpoint
+	switched   func(rawurl string)
+}
+
+// ServeHTTP switches to the endpoint in the "url" form value, with the
+// database, credentials and API version set like for -endpoint. Pending
+// batches are first flushed and delivered to the old endpoint.
+func (e *endpointSwitcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+e.token)) != 1 {
+		elog.Printf("audit: rejected endpoint switch from %s: invalid token", r.RemoteAddr)
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	rawurl := r.FormValue("url")
+	u, err := url.Parse(rawurl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "invalid endpoint URL", http.StatusBadRequest)
+		return
+	}
+	endpoint, err := e.normalize(rawurl)
+	if err != nil {
+		http.Error(w, "invalid endpoint: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	old := e.submitters[0].endpoint.Load().(string)
+	ilog.Printf("audit: endpoint switch from %s to %s requested by %s", redactURL(old), redactURL(rawurl), r.RemoteAddr)
+	e.rs.flush()
+	pending := e.submitters
+	for _, s := range e.forwarders.all() {
+		if s.follow != nil {
+			pending = append(pending, s)
+		}
+	}
+	for _, s := range pending {
+		if !s.drain(e.timeout) {
+			elog.Printf("audit: batches still pending after %v, sending them to the new endpoint", e.timeout)
+			break
+		}
+	}
+	for _, s := range e.submitters {
+		s.setEndpoint(endpoint)
+	}
+	if e.switched != nil {
+		e.switched(rawurl)
+	}
+	stats.Add("endpoint_switches", 1)
+	ilog.Printf("audit: switched endpoint to %s", redactURL(endpoint))
+	fmt.Fprintln(w, "ok")
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// tlsOptions are the TLS settings of a destination.
+type tlsOptions struct {
+	ca         string // file of PEM certificates trusted instead of the system ones
+	cert, key  string // files of the PEM client certificate and its key
+	serverName string // name verified instead of the host of the URL
+	insecure   bool
+}
+
+// parseTLSHost parses a -tls-host value, "HOST key=value..." with keys ca,
+// cert, key, server-name and insecure, into the settings of HOST starting
+// from the global ones in def.
+func parseTLSHost(s string, def tlsOptions) (string, tlsOptions, error) {
+	fs := strings.Fields(s)
+	if len(fs) == 0 {
+		return "", def, errors.New("missing host")
+	}
+	o := def
+	for _, f := range fs[1:] {
+		kv := strings.SplitN(f, "=", 2)
+		if kv[0] == "insecure" && len(kv) == 1 {
+			kv = append(kv, "true")
+		}
+		if len(kv) != 2 {
+			return "", def, fmt.Errorf("expected key=value, got %q", f)
+		}
+		switch kv[0] {
+		case "ca":
+			o.ca = kv[1]
+		case "cert":
+			o.cert = kv[1]
+		case "key":
+			o.key = kv[1]
+		case "server-name":
+			o.serverName = kv[1]
+		case "insecure":
+			b, err := strconv.ParseBool(kv[1])
+			if err != nil {
+				return "", def, fmt.Errorf("invalid insecure: %v", err)
+			}
+			o.insecure = b
+		default:
+			return "", def, fmt.Errorf("unknown setting %q", kv[0])
+		}
+	}
+	return fs[0], o, nil
+}
+
+func (o tlsOptions) config() (*tls.Config, error) {
+	c := &tls.Config{InsecureSkipVerify: o.insecure, ServerName: o.serverName}
+	if o.ca != "" {
+		b, err := ioutil.ReadFile(o.ca)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA certificates: %v", err)
+		}
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("%s: no PEM certificates found", o.ca)
+		}
+	}
+	if o.cert != "" || o.key != "" {
+		if o.cert == "" || o.key == "" {
+			return nil, errors.New("a client certificate requires both cert and key")
+		}
+		cert, err := tls.LoadX509KeyPair(o.cert, o.key)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %v", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+// hostTransport sends the requests to each host through its own transport,
+// so that destinations can have different TLS settings. Hosts are matched
+// as HOST:PORT first, then as HOST.
+type hostTransport struct {
+	def   *http.Transport
+	hosts map[string]*http.Transport
+}
+
+func (t *hostTransport) transport(req *http.Request) *http.Transport {
+	if tr, ok := t.hosts[req.URL.Host]; ok {
+		return tr
+	}
+	if tr, ok := t.hosts[req.URL.Hostname()]; ok {
+		return tr
+	}
+	return t.def
+}
+
+func (t *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.transport(req).RoundTrip(req)
+}
+
+func (t *hostTransport) CloseIdleConnections() {
+	t.def.CloseIdleConnections()
+	for _, tr := range t.hosts {
+		tr.CloseIdleConnections()
+	}
+}
+
+// transports returns all the transports, to configure them alike.
+func (t *hostTransport) transports() []*http.Transport {
+	trs := []*http.Transport{t.def}
+	for _, tr := range t.hosts {
+		trs = append(trs, tr)
+	}
+	return trs
+}
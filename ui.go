@@ -0,0 +1,133 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var uiTemplate = template.Must(template.New("ui").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width">
+<title>influxin</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: .2em .5em; text-align: left; }
+pre { background: #f4f4f4; padding: .5em; overflow-x: auto; }
+.down { color: #b00; }
+</style>
+</head>
+<body>
+<h1>influxin</h1>
+<h2>Throughput</h2>
+<canvas id="graph" width="600" height="120"></canvas>
+<div id="rate"></div>
+<form method="post" action="/ui/flush"><button>Flush now</button></form>
+<h2>Commands</h2>
+<table>
+<tr><th>#</th><th>Command</th><th>State</th><th>Started</th><th>Restarts</th><th>Last error</th><th></th></tr>
+{{range .Commands}}<tr>
+<td>{{.ID}}</td><td>{{.Name}}</td>
+<td{{if not .Running}} class="down"{{end}}>{{if .Running}}running{{else}}stopped{{end}}</td>
+<td>{{.Started.Format "2006-01-02 15:04:05"}}</td><td>{{.Restarts}}</td><td>{{.LastError}}</td>
+<td><form method="post" action="/ui/restart"><input type="hidden" name="id" value="{{.ID}}"><button>Restart</button></form></td>
+</tr>{{end}}
+</table>
+<h2>Submission errors</h2>
+<table>
+<tr>{{range .SubmitErrors}}<th>{{.Class}}</th>{{end}}</tr>
+<tr>{{range .SubmitErrors}}<td>{{.Count}}</td>{{end}}</tr>
+</table>
+<h2>Recent errors</h2>
+<pre>{{range .Errors}}{{.}}{{else}}none{{end}}</pre>
+<script>
+var samples = [], last = null;
+function poll() {
+	fetch("/debug/vars").then(function(r) { return r.json(); }).then(function(v) {
+		var n = (v.influxin && v.influxin.lines) || 0, now = Date.now();
+		if (last) {
+			samples.push((n - last.n) * 1000 / (now - last.t));
+			if (samples.length > 120) samples.shift();
+		}
+		last = {n: n, t: now};
+		draw();
+	});
+}
+function draw() {
+	var c = document.getElementById("graph"), g = c.getContext("2d");
+	var max = Math.max.apply(null, samples.concat([1]));
+	g.clearRect(0, 0, c.width, c.height);
+	g.beginPath();
+	samples.forEach(function(s, i) {
+		var x = i * c.width / 120, y = c.height - s * c.height / max;
+		i ? g.lineTo(x, y) : g.moveTo(x, y);
+	});
+	g.stroke();
+	if (samples.length)
+		document.getElementById("rate").textContent = samples[samples.length-1].toFixed(1) + " lines/s, max " + max.toFixed(1);
+}
+poll();
+setInterval(poll, {{.Interval}});
+</script>
+</body>
+</html>
+`))
+
+// serveUI registers a small status page on the admin listener, with
+// buttons to flush the batches and restart commands.
+func serveUI(rs *results, recorder *flightRecorder) {
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		type classCount struct {
+			Class string
+			Count string
+		}
+		var counts []classCount
+		for _, c := range errorClasses {
+			counts = append(counts, classCount{c, submitErrors.Get(c).String()})
+		}
+		data := struct {
+			Commands     []cmdStatus
+			SubmitErrors []classCount
+			Errors       []string
+			Interval     int64
+		}{
+			Commands:     cmdStatuses(),
+			SubmitErrors: counts,
+			Errors:       recorder.recentErrors(),
+			Interval:     int64(2 * time.Second / time.Millisecond),
+		}
+		if err := uiTemplate.Execute(w, data); err != nil {
+			elog.Printf("cannot render admin UI: %v", err)
+		}
+	})
+	http.HandleFunc("/ui/flush", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		ilog.Printf("flush requested from %s", r.RemoteAddr)
+		rs.flush()
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+	http.HandleFunc("/ui/restart", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "use POST", http.StatusMethodNotAllowed)
+			return
+		}
+		id, err := strconv.Atoi(r.FormValue("id"))
+		if err != nil || !cmdRestart(id) {
+			http.Error(w, "no such running command", http.StatusNotFound)
+			return
+		}
+		ilog.Printf("restart of command #%d requested from %s", id, r.RemoteAddr)
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+}
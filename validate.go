@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// specs are the textual parts of the configuration checked by -validate
+// before anything is started.
+type specs struct {
+	rules        []string
+	inputs       []string
+	filters      map[string]string // flag name to filter
+	continuation string
+	schema       string
+	mapping      string
+	geoip        []string
+	geoipTags    []string
+	quota        int
+	quotaMode    string
+	quotaFor     []string
+	aggregate    []string
+	percentiles  string
+	histogram    string
+	dedupWindow  time.Duration
+	dedupSize    int
+}
+
+// check parses all the specs and reads the files they refer to, and
+// returns every error found instead of stopping at the first one like the
+// startup does.
+func (s specs) check() []error {
+	var errs []error
+	for _, r := range s.rules {
+		if _, err := parseRule(r); err != nil {
+			errs = append(errs, fmt.Errorf("-rule: %v", err))
+		}
+	}
+	for _, spec := range s.inputs {
+		if _, err := parseInput(spec); err != nil {
+			errs = append(errs, fmt.Errorf("-input %q: %v", spec, err))
+		}
+	}
+	names := make([]string, 0, len(s.filters))
+	for name := range s.filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := parseFilter(s.filters[name]); err != nil {
+			errs = append(errs, fmt.Errorf("-%s: %v", name, err))
+		}
+	}
+	if s.continuation != "" {
+		if _, err := regexp.Compile(s.continuation); err != nil {
+			errs = append(errs, fmt.Errorf("-continuation: %v", err))
+		}
+	}
+	if s.schema != "" {
+		if _, err := readSchema(s.schema); err != nil {
+			errs = append(errs, fmt.Errorf("-schema: %v", err))
+		}
+	}
+	if s.mapping != "" {
+		if _, err := readMapping(s.mapping); err != nil {
+			errs = append(errs, fmt.Errorf("-mapping: %v", err))
+		}
+	}
+	if len(s.geoip) > 0 != (len(s.geoipTags) > 0) {
+		errs = append(errs, errors.New("-geoip and -geoip-tag must be used together"))
+	}
+	for _, f := range s.geoip {
+		if _, err := readMMDB(f); err != nil {
+			errs = append(errs, fmt.Errorf("-geoip: %v", err))
+		}
+	}
+	if _, err := newQuotas(s.quota, s.quotaMode, s.quotaFor); err != nil {
+		errs = append(errs, err)
+	}
+	if len(s.aggregate) > 0 {
+		if _, err := newAggregator(s.aggregate, s.percentiles, s.histogram); err != nil {
+			errs = append(errs, fmt.Errorf("-aggregate: %v", err))
+		}
+	}
+	if s.dedupWindow > 0 {
+		if _, err := newDedupTransform(s.dedupWindow, s.dedupSize); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// checkCmdfile returns the commands of a command file with the errors of
+// all its invalid lines, that are skipped.
+func checkCmdfile(path string, mkcmd func() cmd) (cmds, []error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, []error{fmt.Errorf("cannot open command file: %v", err)}
+	}
+	defer f.Close()
+	var (
+		cs   cmds
+		errs []error
+	)
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		c, err := parseCmdLine(line, mkcmd)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %v", path, n, err))
+			continue
+		}
+		cs = append(cs, c)
+	}
+	if err := sc.Err(); err != nil {
+		errs = append(errs, fmt.Errorf("cannot read command file: %v", err))
+	}
+	return cs, errs
+}
+
+// reportProblems logs errs and returns an error counting them, if any.
+func reportProblems(errs []error) error {
+	for _, err := range errs {
+		elog.Print(err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("validation failed with %d problems", len(errs))
+	}
+	return nil
+}
+
+// validate checks that the assembled configuration can actually work on this
+// host. All problems are returned instead of stopping at the first one.
+func validate(endpoint string, cmds cmds) []error {
+	var errs []error
+	if endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("endpoint: cannot parse URL: %v", err))
+		} else if _, err := net.LookupHost(u.Hostname()); err != nil {
+			errs = append(errs, fmt.Errorf("endpoint: cannot resolve host: %v", err))
+		}
+	}
+	for i := range cmds {
+		c := &cmds[i]
+		name := c.name
+		if c.shell != "" {
+			if name = shells[c.shell]; name == "" {
+				errs = append(errs, fmt.Errorf("command #%d: unknown shell %q", i, c.shell))
+				continue
+			}
+		}
+		if _, err := exec.LookPath(name); err != nil {
+			errs = append(errs, fmt.Errorf("command #%d: %v", i, err))
+		}
+		if strings.HasPrefix(c.stdin, "@") {
+			if _, err := os.Stat(c.stdin[1:]); err != nil {
+				errs = append(errs, fmt.Errorf("command #%d: stdin: %v", i, err))
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"hash/fnv"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// filter holds the conditions printed measurements must match. It can be
+// changed while running.
+type filter struct {
+	conds atomic.Value // []*condition
+}
+
+// parseFilter parses space separated conditions, in the same form used
+// by rules.
+func parseFilter(s string) ([]*condition, error) {
+	var conds []*condition
+	for _, w := range strings.Fields(s) {
+		c, err := parseCondition(w)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, c)
+	}
+	return conds, nil
+}
+
+func (f *filter) set(conds []*condition) {
+	f.conds.Store(conds)
+}
+
+func (f *filter) match(p *point) bool {
+	conds, _ := f.conds.Load().([]*condition)
+	return matchAll(conds, p)
+}
+
+// readFilters reads new filter expressions, one per line, from r. An empty
+// line removes the filter.
+func (f *filter) readFilters(r io.Reader) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		conds, err := parseFilter(sc.Text())
+		if err != nil {
+			elog.Printf("invalid filter: %v", err)
+			continue
+		}
+		f.set(conds)
+		if len(conds) == 0 {
+			ilog.Printf("printing all measurements")
+		} else {
+			ilog.Printf("printing measurements matching %s", strings.TrimSpace(sc.Text()))
+		}
+	}
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+var measurementColors = []string{"31", "32", "33", "34", "35", "36", "91", "92", "93", "94", "95", "96"}
+
+// colorize returns line with an ANSI color chosen by measurement.
+func colorize(line, measurement string) string {
+	h := fnv.New32a()
+	h.Write([]byte(measurement))
+	return "\x1b[" + measurementColors[h.Sum32()%uint32(len(measurementColors))] + "m" + line + "\x1b[0m"
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// verifier periodically writes a canary point and queries it back, to
+// check that written data really reaches the database.
+type verifier struct {
+	submitter *submitter
+	client    *http.Client
+	interval  time.Duration
+	instance  string
+
+	mux    sync.Mutex
+	seq    int64
+	last   time.Time // last successful verification
+	lastOK bool
+}
+
+func newVerifier(s *submitter, client *http.Client, interval time.Duration) *verifier {
+	instance, err := os.Hostname()
+	if err != nil {
+		instance = "unknown"
+	}
+	return &verifier{submitter: s, client: client, interval: interval, instance: instance}
+}
+
+// queryURL returns the query endpoint of the same server and database as
+// the write endpoint.
+func queryURL(endpoint, q string) (string, error) {
+	u, err := apiURL(endpoint, "query")
+	if err != nil {
+		return "", err
+	}
+	vals := url.Values{}
+	if eu, err := url.Parse(endpoint); err == nil && eu.Query().Get("db") != "" {
+		vals.Set("db", eu.Query().Get("db"))
+	} else if err == nil && eu.Query().Get("bucket") != "" {
+		// mapped to a bucket by InfluxDB 2
+		vals.Set("db", eu.Query().Get("bucket"))
+	}
+	vals.Set("q", q)
+	u.RawQuery = vals.Encode()
+	return u.String(), nil
+}
+
+func (v *verifier) verify(ctx context.Context) error {
+	v.mux.Lock()
+	v.seq++
+	seq := v.seq
+	v.mux.Unlock()
+	p := &point{measurement: "influxin_canary", tags: []tag{{"instance", v.instance}}}
+	p.setField("seq", strconv.FormatInt(seq, 10)+"i")
+	if err := v.submitter.send(ctx, strings.NewReader(p.String()+"\n"), ""); err != nil {
+		return fmt.Errorf("cannot write canary: %v", err)
+	}
+	q := fmt.Sprintf("SELECT last(seq) FROM influxin_canary WHERE instance = '%s' AND time > now() - %ds",
+		strings.Replace(v.instance, "'", `\'`, -1), int(v.interval/time.Second)+60)
+	qurl, err := queryURL(v.submitter.endpoint.Load().(string), q)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(forEndpoint(ctx), "GET", qurl, nil)
+	if err != nil {
+		return fmt.Errorf("cannot create canary query: %v", err)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot query canary: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cannot query canary: expected status 200, got %s", resp.Status)
+	}
+	var res struct {
+		Results []struct {
+			Series []struct {
+				Values [][]interface{} `json:"values"`
+			} `json:"series"`
+			Error string `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("cannot decode canary query result: %v", err)
+	}
+	if len(res.Results) == 0 || len(res.Results[0].Series) == 0 || len(res.Results[0].Series[0].Values) == 0 {
+		if len(res.Results) > 0 && res.Results[0].Error != "" {
+			return fmt.Errorf("canary query failed: %s", res.Results[0].Error)
+		}
+		return fmt.Errorf("canary %d not found", seq)
+	}
+	row := res.Results[0].Series[0].Values[0]
+	if len(row) < 2 {
+		return fmt.Errorf("unexpected canary query result %v", row)
+	}
+	if got, ok := row[1].(float64); !ok || int64(got) != seq {
+		return fmt.Errorf("canary %d not found, last is %v", seq, row[1])
+	}
+	return nil
+}
+
+func (v *verifier) run(ctx context.Context) {
+	for {
+		start := time.Now()
+		err := v.verify(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		v.mux.Lock()
+		v.lastOK = err == nil
+		if err == nil {
+			v.last = time.Now()
+		}
+		v.mux.Unlock()
+		if err != nil {
+			stats.Add("canary_failures", 1)
+			stats.Set("canary_ok", expvarInt(0))
+			elog.Printf("end to end verification failed: %v", err)
+		} else {
+			stats.Set("canary_ok", expvarInt(1))
+			stats.Set("canary_last_ms", expvarFloat(float64(time.Since(start))/float64(time.Millisecond)))
+		}
+		if !sleep(ctx, v.interval) {
+			return
+		}
+	}
+}
+
+// ready reports whether the last verification succeeded recently.
+func (v *verifier) ready() bool {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	return v.lastOK && time.Since(v.last) < 3*v.interval
+}
+
+func expvarInt(n int64) *expvar.Int {
+	v := new(expvar.Int)
+	v.Set(n)
+	return v
+}
+
+func expvarFloat(f float64) *expvar.Float {
+	v := new(expvar.Float)
+	v.Set(f)
+	return v
+}